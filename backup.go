@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPluginsFile             = "plugins.txt"
+	backupJobsDirectory           = "jobs"
+	backupViewsDirectory          = "views"
+	backupNodesDirectory          = "nodes"
+	backupSystemCredentialsFile   = "credentials-system.age"
+	backupFolderCredentialsFile   = "credentials-folders.age"
+	backupConfigurationAsCodeFile = "jenkins.yaml"
+)
+
+type BackupOptions struct {
+	Recipients      []string
+	Passphrase      string
+	SkipCredentials bool
+}
+
+type RestoreOptions struct {
+	IdentityFiles   []string
+	Passphrase      string
+	SkipPlugins     bool
+	SkipCredentials bool
+	ApplyCasc       bool
+	Timeout         time.Duration
+}
+
+var folderConfigPattern = regexp.MustCompile(`^\s*(<\?xml[^?]*\?>)?\s*<[^\s>]*Folder[\s>/]`)
+
+// isFolderConfig tells whether a config.xml is the one of a folder, the same
+// way Job.IsFolder does for the class of a job.
+func isFolderConfig(config []byte) bool {
+	return folderConfigPattern.Match(config)
+}
+
+// Backup writes everything butler can export to a new, timestamped directory
+// below parent and returns its path. Credentials are only written encrypted.
+// Only the views of the controller are backed up separately, the views of
+// folders are part of the folder configs and restored with the folders.
+func Backup(server string, username string, password string, parent string, options BackupOptions) (string, error) {
+	if !options.SkipCredentials && len(options.Recipients) == 0 && options.Passphrase == "" {
+		return "", errors.New("Credentials are only backed up encrypted: set a recipient or a passphrase, or skip credentials")
+	}
+
+	directory := filepath.Join(parent, "butler-backup-"+time.Now().Format("20060102-150405"))
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("Backing up plugins")
+	plugins, err := GetPlugins(server, username, password)
+	if err != nil {
+		return directory, err
+	}
+	err = writePluginsFile(filepath.Join(directory, backupPluginsFile), plugins)
+	if err != nil {
+		return directory, err
+	}
+
+	err = backupJobs(server, username, password, filepath.Join(directory, backupJobsDirectory))
+	if err != nil {
+		return directory, err
+	}
+
+	if !options.SkipCredentials {
+		err = backupCredentials(server, username, password, directory, options)
+		if err != nil {
+			return directory, err
+		}
+	}
+
+	fmt.Println("Backing up views")
+	err = ExportViews(server, "", username, password, filepath.Join(directory, backupViewsDirectory))
+	if err != nil {
+		return directory, err
+	}
+
+	fmt.Println("Backing up nodes")
+	err = ExportNodes(server, username, password, filepath.Join(directory, backupNodesDirectory))
+	if err != nil {
+		return directory, err
+	}
+
+	fmt.Println("Backing up configuration as code")
+	casc, err := GetCascConfiguration(server, username, password)
+	if err != nil {
+		fmt.Printf("\tConfiguration as code skipped: %v\n", err)
+	} else {
+		err = ioutil.WriteFile(filepath.Join(directory, backupConfigurationAsCodeFile), casc, 0600)
+		if err != nil {
+			return directory, err
+		}
+	}
+
+	return directory, nil
+}
+
+// backupJobs writes the config.xml of every job and folder to
+// <directory>/<full name>/config.xml.
+func backupJobs(server string, username string, password string, directory string) error {
+	httpClient := &JenkinsHTTPClient{
+		BasicAuthSettings: BasicAuthSettings{
+			Username: username,
+			Password: password,
+		},
+	}
+	rootJob := NewJob(server, "", httpClient)
+	jobs, err := rootJob.GetJobs()
+	if err != nil {
+		return err
+	}
+	jobs, err = jobs.GetJobsRecursively()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Jobs {
+		name, err := neturl.PathUnescape(job.GetFolderName())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backing up job: %s\n", name)
+		config, err := GetJobConfig(job, username, password)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Join(directory, name), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(directory, name, "config.xml"), config, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backupCredentials(server string, username string, password string, directory string, options BackupOptions) error {
+	fmt.Println("Backing up credentials")
+	out, err := OpenCredentialsOutput(filepath.Join(directory, backupSystemCredentialsFile), options.Recipients, options.Passphrase, false)
+	if err != nil {
+		return err
+	}
+	err = DecryptSystemCredentials(server, username, password, out)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	out, err = OpenCredentialsOutput(filepath.Join(directory, backupFolderCredentialsFile), options.Recipients, options.Passphrase, false)
+	if err != nil {
+		return err
+	}
+	err = DecryptFolderCredentialsRecursively(server, "", username, password, out)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// getBackupJobs returns the full names of the jobs of a backup, folders
+// first and every folder before its content.
+func getBackupJobs(directory string) (folders []string, jobs []string, err error) {
+	if !fileExists(directory) {
+		return
+	}
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != "config.xml" {
+			return err
+		}
+		config, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(directory, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if isFolderConfig(config) {
+			folders = append(folders, filepath.ToSlash(name))
+		} else {
+			jobs = append(jobs, filepath.ToSlash(name))
+		}
+		return nil
+	})
+	sort.Strings(folders)
+	sort.Strings(jobs)
+	return
+}
+
+// restoreJobs creates the jobs which don't exist yet. Jobs that can't be
+// created are reported and skipped, the error lists them.
+func restoreJobs(server string, username string, password string, directory string, names []string) error {
+	failed := make([]string, 0)
+	for _, name := range names {
+		exists, err := itemExists(GetFolderURL(server, name), username, password)
+		if err != nil {
+			return err
+		}
+		if exists {
+			fmt.Printf("Job %s already exists, skipping\n", name)
+			continue
+		}
+
+		fmt.Printf("Restoring job: %s\n", name)
+		config, err := ioutil.ReadFile(filepath.Join(directory, name, "config.xml"))
+		if err != nil {
+			return err
+		}
+		folderName, jobName := filepath.Split(name)
+		err = CreateJob(server, folderName, jobName, username, password, config)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Jobs couldn't be restored: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func restoreCredentials(server string, username string, password string, directory string, options RestoreOptions) error {
+	fmt.Println("Restoring credentials")
+	in, err := OpenCredentialsInput(filepath.Join(directory, backupSystemCredentialsFile), options.IdentityFiles, options.Passphrase)
+	if err != nil {
+		return err
+	}
+	err = ApplyFolderCredentials(server, "", username, password, in, nil)
+	if err != nil {
+		return err
+	}
+
+	in, err = OpenCredentialsInput(filepath.Join(directory, backupFolderCredentialsFile), options.IdentityFiles, options.Passphrase)
+	if err != nil {
+		return err
+	}
+	return ApplyFolderCredentialsRecursively(server, "", username, password, in, nil)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Restore reapplies a backup in dependency order: plugins, the configuration
+// as code if asked for, folders, credentials, nodes, jobs and views. Jenkins
+// installs plugins in the background, so Restore waits for them and restarts
+// Jenkins if needed before the items are created. Items that can't be created
+// are reported and skipped, and make Restore fail at the end.
+func Restore(server string, username string, password string, directory string, options RestoreOptions) error {
+	if !fileExists(filepath.Join(directory, backupPluginsFile)) {
+		return fmt.Errorf("%s is not a butler backup", directory)
+	}
+
+	if !options.SkipPlugins {
+		fmt.Println("Restoring plugins")
+		err := ImportPluginsFromFile(server, username, password, filepath.Join(directory, backupPluginsFile))
+		if err != nil {
+			return err
+		}
+
+		restart, err := WaitForPluginInstalls(server, username, password, options.Timeout)
+		if err != nil {
+			return err
+		}
+		if restart {
+			fmt.Println("Restarting Jenkins to load the plugins")
+			err = SafeRestart(server, username, password, options.Timeout)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if options.ApplyCasc && fileExists(filepath.Join(directory, backupConfigurationAsCodeFile)) {
+		fmt.Println("Restoring configuration as code")
+		err := ApplyCasc(server, username, password, filepath.Join(directory, backupConfigurationAsCodeFile), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	failures := make([]string, 0)
+	jobsDirectory := filepath.Join(directory, backupJobsDirectory)
+	folders, jobs, err := getBackupJobs(jobsDirectory)
+	if err != nil {
+		return err
+	}
+	err = restoreJobs(server, username, password, jobsDirectory, folders)
+	if err != nil {
+		failures = append(failures, err.Error())
+	}
+
+	if !options.SkipCredentials && fileExists(filepath.Join(directory, backupSystemCredentialsFile)) {
+		err = restoreCredentials(server, username, password, directory, options)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if fileExists(filepath.Join(directory, backupNodesDirectory)) {
+		err = ImportNodes(server, username, password, filepath.Join(directory, backupNodesDirectory), nil)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	err = restoreJobs(server, username, password, jobsDirectory, jobs)
+	if err != nil {
+		failures = append(failures, err.Error())
+	}
+
+	if fileExists(filepath.Join(directory, backupViewsDirectory)) {
+		err = ImportViews(server, "", username, password, filepath.Join(directory, backupViewsDirectory))
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Restore incomplete: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFolderConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		want   bool
+	}{
+		{"<?xml version='1.1' encoding='UTF-8'?>\n<com.cloudbees.hudson.plugins.folder.Folder plugin=\"cloudbees-folder@6.9\">", true},
+		{"<jenkins.branch.OrganizationFolder>", true},
+		{"<?xml version='1.1' encoding='UTF-8'?>\n<flow-definition plugin=\"workflow-job@1289\">", false},
+		{"<project><description>Folder</description></project>", false},
+	}
+	for _, tt := range tests {
+		if got := isFolderConfig([]byte(tt.config)); got != tt.want {
+			t.Errorf("isFolderConfig(%q) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
+
+func writeBackupFile(t *testing.T, directory string, path string, content string) {
+	path = filepath.Join(directory, path)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-backup")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+
+	writeBackupFile(t, directory, "plugins.txt", "cloudbees-folder@6.9\n")
+	writeBackupFile(t, directory, "jobs/top/config.xml", "<project/>")
+	writeBackupFile(t, directory, "jobs/team/config.xml", "<com.cloudbees.hudson.plugins.folder.Folder/>")
+	writeBackupFile(t, directory, "jobs/team/app/config.xml", "<flow-definition/>")
+	writeBackupFile(t, directory, "jobs/my team/config.xml", "<com.cloudbees.hudson.plugins.folder.Folder/>")
+	writeBackupFile(t, directory, "jobs/my team/app #1/config.xml", "<flow-definition/>")
+	writeBackupFile(t, directory, "nodes/agent1/config.xml", "<slave/>")
+	writeBackupFile(t, directory, "views/dev/config.xml", "<hudson.model.ListView/>")
+
+	var requests []string
+	updateCenterPolls, restarted, downPolls := 0, false, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/crumbIssuer/api/xml":
+			w.Write([]byte("Jenkins-Crumb:abc"))
+		case r.URL.Path == "/updateCenter/api/json":
+			updateCenterPolls++
+			if updateCenterPolls == 1 {
+				w.Write([]byte(`{"jobs":[{"name":"cloudbees-folder","status":{"type":"Installing"}}],"restartRequiredForCompletion":false}`))
+				return
+			}
+			w.Write([]byte(`{"jobs":[{"name":"cloudbees-folder","status":{"type":"SuccessButRequiresRestart"}}],"restartRequiredForCompletion":true}`))
+		case r.URL.Path == "/api/json":
+			if restarted && downPolls == 0 {
+				downPolls++
+				w.WriteHeader(503)
+				return
+			}
+			w.Write([]byte(`{"mode":"NORMAL"}`))
+		case r.Method == "GET":
+			w.WriteHeader(404)
+		default:
+			requests = append(requests, r.URL.RequestURI())
+			if r.URL.Path == "/safeRestart" {
+				restarted = true
+				http.Redirect(w, r, "/", http.StatusFound)
+			}
+		}
+	}))
+	defer server.Close()
+	pluginPollInterval = time.Millisecond
+	defer func() { pluginPollInterval = 5 * time.Second }()
+
+	err = Restore(server.URL, "user", "password", directory, RestoreOptions{SkipCredentials: true})
+
+	assert.Nil(err)
+	assert.Equal(2, updateCenterPolls)
+	assert.Equal([]string{
+		"/pluginManager/installNecessaryPlugins",
+		"/safeRestart",
+		"/createItem?name=my+team",
+		"/createItem?name=team",
+		"/computer/doCreateItem",
+		"/computer/agent1/config.xml",
+		"/job/my%20team/createItem?name=app+%231",
+		"/job/team/createItem?name=app",
+		"/createItem?name=top",
+		"/createView?name=dev",
+	}, requests)
+}
+
+func TestRestore_Failures(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-backup")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+
+	writeBackupFile(t, directory, "plugins.txt", "cloudbees-folder@6.9\n")
+	writeBackupFile(t, directory, "jobs/top/config.xml", "<project/>")
+	writeBackupFile(t, directory, "jobs/existing/config.xml", "<project/>")
+	writeBackupFile(t, directory, "jobs/broken/config.xml", "<unknown-plugin-job/>")
+	writeBackupFile(t, directory, "views/dev/config.xml", "<hudson.model.ListView/>")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/crumbIssuer/api/xml":
+			w.Write([]byte("Jenkins-Crumb:abc"))
+		case r.URL.Path == "/job/existing/api/json":
+			w.Write([]byte(`{}`))
+		case r.Method == "GET":
+			w.WriteHeader(404)
+		default:
+			requests = append(requests, r.URL.RequestURI())
+			if r.URL.Query().Get("name") == "broken" || r.URL.Path == "/createView" {
+				w.WriteHeader(500)
+			}
+		}
+	}))
+	defer server.Close()
+
+	err = Restore(server.URL, "user", "password", directory, RestoreOptions{SkipPlugins: true})
+
+	assert.EqualError(err, "Restore incomplete: Jobs couldn't be restored: broken; Views couldn't be imported: dev")
+	assert.Equal([]string{
+		"/createItem?name=broken",
+		"/createItem?name=top",
+		"/createView?name=dev",
+	}, requests)
+}
+
+func TestRestore_NotABackup(t *testing.T) {
+	directory, err := ioutil.TempDir("", "butler-backup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	err = Restore("http://localhost:8080", "user", "password", directory, RestoreOptions{})
+
+	assert.NotNil(t, err)
+}
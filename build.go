@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BuildOptions struct {
+	Parameters map[string]string
+	Wait       bool
+	Follow     bool
+	Timeout    time.Duration
+}
+
+type QueueItem struct {
+	Cancelled  bool   `json:"cancelled"`
+	Why        string `json:"why"`
+	Executable *struct {
+		Number int `json:"number"`
+	} `json:"executable"`
+}
+
+type Build struct {
+	Building bool   `json:"building"`
+	Result   string `json:"result"`
+}
+
+// buildExitCodes maps build results to the exit code of jobs build.
+var buildExitCodes = map[string]int{
+	"SUCCESS":   0,
+	"FAILURE":   1,
+	"UNSTABLE":  2,
+	"ABORTED":   3,
+	"NOT_BUILT": 4,
+}
+
+// buildPollInterval is how often the queue item and build are checked.
+var buildPollInterval = 2 * time.Second
+
+var queueItemPattern = regexp.MustCompile(`/queue/item/(\d+)/?$`)
+
+func GetBuildExitCode(result string) int {
+	if code, ok := buildExitCodes[result]; ok {
+		return code
+	}
+	return 1
+}
+
+// IsParameterizedJob returns whether the job defines build parameters.
+func IsParameterizedJob(server string, jobPath string, username string, password string) (bool, error) {
+	var job struct {
+		Property []struct {
+			ParameterDefinitions []struct {
+				Name string `json:"name"`
+			} `json:"parameterDefinitions"`
+		} `json:"property"`
+	}
+	err := getJSON(GetFolderURL(server, jobPath)+"/api/json?tree=property[parameterDefinitions[name]]", username, password, &job)
+	if err != nil {
+		return false, err
+	}
+	for _, property := range job.Property {
+		if len(property.ParameterDefinitions) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TriggerBuild queues a build of the job and returns the URL of the queue
+// item. Parameterized jobs are built with buildWithParameters, which uses the
+// default of every parameter that is not given, as /build rejects them.
+func TriggerBuild(server string, jobPath string, username string, password string, parameters map[string]string) (string, error) {
+	parameterized := len(parameters) > 0
+	if !parameterized {
+		// a job that can't be read is reported by the trigger itself
+		parameterized, _ = IsParameterizedJob(server, jobPath, username, password)
+	}
+
+	url := GetFolderURL(server, jobPath) + "/build"
+	values := neturl.Values{}
+	if parameterized {
+		url = GetFolderURL(server, jobPath) + "/buildWithParameters"
+		for name, value := range parameters {
+			values.Set(name, value)
+		}
+	}
+
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(username, password)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No crumb issueing possible: %v\n", err)
+	} else {
+		req.Header.Set(crumb[0], crumb[1])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return "", errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode == 404 {
+		return "", fmt.Errorf("Job %s not found", jobPath)
+	}
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return "", fmt.Errorf("Build of %s couldn't be triggered: %s", jobPath, resp.Status)
+	}
+
+	// the location uses the root URL Jenkins is configured with, which may
+	// not be the server used here
+	match := queueItemPattern.FindStringSubmatch(resp.Header.Get("Location"))
+	if match == nil {
+		return "", fmt.Errorf("Build of %s was triggered, but Jenkins returned no queue item", jobPath)
+	}
+	return fmt.Sprintf("%s/queue/item/%s", server, match[1]), nil
+}
+
+func getJSON(url string, username string, password string, value interface{}) error {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s cannot be read: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// pastDeadline tells whether a deadline is set and has passed. A zero
+// deadline never passes.
+func pastDeadline(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// WaitForBuildStart waits until a queue item is a build and returns its
+// number. A zero deadline waits forever.
+func WaitForBuildStart(queueURL string, username string, password string, deadline time.Time) (int, error) {
+	for {
+		var item QueueItem
+		err := getJSON(queueURL+"/api/json", username, password, &item)
+		if err != nil {
+			return 0, err
+		}
+
+		if item.Cancelled {
+			return 0, errors.New("Build was cancelled while queued")
+		}
+		if item.Executable != nil {
+			return item.Executable.Number, nil
+		}
+		if pastDeadline(deadline) {
+			return 0, fmt.Errorf("Build is still queued at the timeout: %s", item.Why)
+		}
+
+		time.Sleep(buildPollInterval)
+	}
+}
+
+// FollowBuildLog streams the console log of a build to out until it is done.
+// A zero deadline follows it forever.
+func FollowBuildLog(buildURL string, username string, password string, out io.Writer, deadline time.Time) error {
+	start := "0"
+	client := &http.Client{}
+	for {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/logText/progressiveText?start=%s", buildURL, start), nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(username, password)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return fmt.Errorf("Console log of %s cannot be read: %s", buildURL, resp.Status)
+		}
+
+		_, err = io.Copy(out, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if size := resp.Header.Get("X-Text-Size"); size != "" {
+			start = size
+		}
+		if resp.Header.Get("X-More-Data") != "true" {
+			return nil
+		}
+		if pastDeadline(deadline) {
+			return fmt.Errorf("Build %s is still running at the timeout", buildURL)
+		}
+
+		time.Sleep(buildPollInterval)
+	}
+}
+
+// WaitForBuildResult waits until a build is done and returns its result. A
+// zero deadline waits forever.
+func WaitForBuildResult(buildURL string, username string, password string, deadline time.Time) (string, error) {
+	for {
+		var build Build
+		err := getJSON(buildURL+"/api/json?tree=building,result", username, password, &build)
+		if err != nil {
+			return "", err
+		}
+
+		if !build.Building && build.Result != "" {
+			return build.Result, nil
+		}
+		if pastDeadline(deadline) {
+			return "", fmt.Errorf("Build %s is still running at the timeout", buildURL)
+		}
+
+		time.Sleep(buildPollInterval)
+	}
+}
+
+// BuildJob triggers a build of the job and, if asked to, waits for it and
+// streams its console log. The timeout limits all of the waiting, counted
+// from the trigger. It returns the result of the build, or an empty result
+// when it did not wait.
+func BuildJob(server string, jobPath string, username string, password string, options BuildOptions) (string, error) {
+	var deadline time.Time
+	if options.Timeout > 0 {
+		deadline = time.Now().Add(options.Timeout)
+	}
+
+	queueURL, err := TriggerBuild(server, jobPath, username, password, options.Parameters)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Build of %s queued: %s\n", jobPath, queueURL)
+
+	if !options.Wait && !options.Follow {
+		return "", nil
+	}
+
+	number, err := WaitForBuildStart(queueURL, username, password, deadline)
+	if err != nil {
+		return "", err
+	}
+	buildURL := GetFolderURL(server, jobPath) + "/" + strconv.Itoa(number)
+	fmt.Fprintf(os.Stderr, "Build #%d started: %s\n", number, buildURL)
+
+	if options.Follow {
+		err = FollowBuildLog(buildURL, username, password, os.Stdout, deadline)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	result, err := WaitForBuildResult(buildURL, username, password, deadline)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Build #%d finished: %s\n", number, result)
+	return result, nil
+}
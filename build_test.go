@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newBuildServer serves job team/app, whose build #12 starts after one poll
+// of its queue item, logs two chunks and fails. With parameterized, the job
+// has a parameter and rejects builds without parameters like Jenkins does.
+func newBuildServer(t *testing.T, parameterized bool) *testJenkinsServer {
+	queuePolls, buildPolls := 0, 0
+	trigger := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "abc", r.Header.Get("Jenkins-Crumb"))
+		if parameterized && r.URL.Path == "/job/team/job/app/build" {
+			w.WriteHeader(400)
+			return
+		}
+		w.Header().Set("Location", "https://jenkins.example.com/queue/item/7/")
+		w.WriteHeader(201)
+	}
+	return newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/job/team/job/app/api/json": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "property[parameterDefinitions[name]]", r.URL.Query().Get("tree"))
+			if parameterized {
+				w.Write([]byte(`{"property":[{},{"parameterDefinitions":[{"name":"VERSION"}]}]}`))
+				return
+			}
+			w.Write([]byte(`{"property":[{}]}`))
+		},
+		"/job/team/job/app/build":               trigger,
+		"/job/team/job/app/buildWithParameters": trigger,
+		"/queue/item/7/api/json": func(w http.ResponseWriter, r *http.Request) {
+			queuePolls++
+			if queuePolls == 1 {
+				w.Write([]byte(`{"why":"Waiting for next available executor","executable":null}`))
+				return
+			}
+			w.Write([]byte(`{"executable":{"number":12}}`))
+		},
+		"/job/team/job/app/12/logText/progressiveText": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("start") == "0" {
+				w.Header().Set("X-Text-Size", "6")
+				w.Header().Set("X-More-Data", "true")
+				w.Write([]byte("first\n"))
+				return
+			}
+			assert.Equal(t, "6", r.URL.Query().Get("start"))
+			w.Header().Set("X-Text-Size", "13")
+			w.Write([]byte("second\n"))
+		},
+		"/job/team/job/app/12/api/json": func(w http.ResponseWriter, r *http.Request) {
+			buildPolls++
+			if buildPolls == 1 {
+				w.Write([]byte(`{"building":true,"result":null}`))
+				return
+			}
+			w.Write([]byte(`{"building":false,"result":"FAILURE"}`))
+		},
+	})
+}
+
+func TestBuildJob(t *testing.T) {
+	buildPollInterval = time.Millisecond
+	defer func() { buildPollInterval = 2 * time.Second }()
+
+	tests := []struct {
+		name          string
+		parameterized bool
+		options       BuildOptions
+		wantTriggered string
+		wantResult    string
+	}{
+		{"trigger", false, BuildOptions{}, "/job/team/job/app/build?", ""},
+		{"parameters", true, BuildOptions{Parameters: map[string]string{"VERSION": "1.2.3", "ENV": "prod"}, Wait: true}, "/job/team/job/app/buildWithParameters?ENV=prod&VERSION=1.2.3", "FAILURE"},
+		{"default parameters", true, BuildOptions{Wait: true, Timeout: time.Minute}, "/job/team/job/app/buildWithParameters?", "FAILURE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newBuildServer(t, tt.parameterized)
+			defer server.Close()
+
+			result, err := BuildJob(server.URL, "team/app", "user", "password", tt.options)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantResult, result)
+			var triggered []string
+			for _, request := range server.Requests("/job/team/job/app/build", "/job/team/job/app/buildWithParameters") {
+				triggered = append(triggered, request.Path+"?"+request.Form.Encode())
+			}
+			assert.Equal(t, []string{tt.wantTriggered}, triggered)
+		})
+	}
+}
+
+func TestFollowBuildLog(t *testing.T) {
+	buildPollInterval = time.Millisecond
+	defer func() { buildPollInterval = 2 * time.Second }()
+	server := newBuildServer(t, false)
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := FollowBuildLog(server.URL+"/job/team/job/app/12", "user", "password", &out, time.Now().Add(time.Minute))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "first\nsecond\n", out.String())
+}
+
+func TestWaitForBuildStart_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cancelled":true}`))
+	}))
+	defer server.Close()
+
+	_, err := WaitForBuildStart(server.URL+"/queue/item/7", "user", "password", time.Time{})
+
+	assert.EqualError(t, err, "Build was cancelled while queued")
+}
+
+func TestWaitForBuild_Timeout(t *testing.T) {
+	buildPollInterval = time.Millisecond
+	defer func() { buildPollInterval = 2 * time.Second }()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"why":"Waiting for next available executor","building":true}`))
+	}))
+	defer server.Close()
+
+	_, err := WaitForBuildStart(server.URL+"/queue/item/7", "user", "password", time.Now().Add(10*time.Millisecond))
+	assert.EqualError(t, err, "Build is still queued at the timeout: Waiting for next available executor")
+
+	_, err = WaitForBuildResult(server.URL+"/job/app/12", "user", "password", time.Now().Add(10*time.Millisecond))
+	assert.EqualError(t, err, "Build "+server.URL+"/job/app/12 is still running at the timeout")
+}
+
+func TestBuildJob_Timeout(t *testing.T) {
+	buildPollInterval = time.Millisecond
+	defer func() { buildPollInterval = 2 * time.Second }()
+	buildPolls := 0
+	server := newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/job/my team/job/app/api/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"property":[]}`))
+		},
+		"/job/my team/job/app/build": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "https://jenkins.example.com/queue/item/7/")
+			w.WriteHeader(201)
+		},
+		"/queue/item/7/api/json": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{"executable":{"number":12}}`))
+		},
+		"/job/my team/job/app/12/api/json": func(w http.ResponseWriter, r *http.Request) {
+			buildPolls++
+			w.Write([]byte(`{"building":true}`))
+		},
+	})
+	defer server.Close()
+
+	// the build starts after the timeout, so there is no time left to wait
+	// for its result
+	_, err := BuildJob(server.URL, "my team/app", "user", "password", BuildOptions{Wait: true, Timeout: 10 * time.Millisecond})
+
+	assert.EqualError(t, err, "Build "+server.URL+"/job/my%20team/job/app/12 is still running at the timeout")
+	assert.Equal(t, 1, buildPolls)
+	assert.Len(t, server.Requests("/job/my team/job/app/build"), 1)
+}
+
+func TestGetBuildExitCode(t *testing.T) {
+	assert.Equal(t, 0, GetBuildExitCode("SUCCESS"))
+	assert.Equal(t, 1, GetBuildExitCode("FAILURE"))
+	assert.Equal(t, 2, GetBuildExitCode("UNSTABLE"))
+	assert.Equal(t, 3, GetBuildExitCode("ABORTED"))
+	assert.Equal(t, 1, GetBuildExitCode("SOMETHING_NEW"))
+}
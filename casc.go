@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// postCasc posts body to an endpoint of the configuration-as-code plugin and
+// returns the response body and status code.
+func postCasc(server string, username string, password string, endpoint string, body []byte) ([]byte, int, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/configuration-as-code/%s", server, endpoint), bytes.NewReader(body))
+	if err != nil {
+		return []byte{}, 0, err
+	}
+	req.SetBasicAuth(username, password)
+	req.Header.Set("Content-Type", "application/x-yaml")
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No crumb issueing possible: %v\n", err)
+	} else {
+		req.Header.Set(crumb[0], crumb[1])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return []byte{}, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return []byte{}, resp.StatusCode, errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode == 404 {
+		return []byte{}, resp.StatusCode, errors.New("Configuration as Code plugin not found 404")
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, resp.StatusCode, err
+}
+
+// GetCascConfiguration returns the current configuration of the controller as
+// Configuration-as-Code YAML.
+func GetCascConfiguration(server string, username string, password string) ([]byte, error) {
+	data, status, err := postCasc(server, username, password, "export", []byte{})
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if status != 200 {
+		return []byte{}, fmt.Errorf("Configuration couldn't be exported: %d %s", status, bytes.TrimSpace(data))
+	}
+
+	return data, nil
+}
+
+// ExportCasc writes the Configuration-as-Code YAML to output, or prints it.
+func ExportCasc(server string, username string, password string, output string) error {
+	data, err := GetCascConfiguration(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		fmt.Printf("%s", data)
+		return nil
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
+
+// CascWarning is a problem the configuration-as-code plugin found in a
+// configuration.
+type CascWarning struct {
+	Line    int    `json:"line"`
+	Warning string `json:"warning"`
+}
+
+// CheckCasc validates Configuration-as-Code YAML without applying it. The
+// plugin answers 200 with a list of warnings, an invalid configuration is
+// one with warnings.
+func CheckCasc(server string, username string, password string, configuration []byte) error {
+	data, status, err := postCasc(server, username, password, "check", configuration)
+	if err != nil {
+		return err
+	}
+
+	if status != 200 {
+		return fmt.Errorf("Configuration is invalid: %s", bytes.TrimSpace(data))
+	}
+
+	var warnings []CascWarning
+	if len(bytes.TrimSpace(data)) > 0 {
+		err = json.Unmarshal(data, &warnings)
+		if err != nil {
+			return fmt.Errorf("Configuration check couldn't be read: %v", err)
+		}
+	}
+
+	if len(warnings) > 0 {
+		problems := make([]string, 0, len(warnings))
+		for _, warning := range warnings {
+			problems = append(problems, fmt.Sprintf("line %d: %s", warning.Line, warning.Warning))
+		}
+		return fmt.Errorf("Configuration is invalid: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// ApplyCasc validates the Configuration-as-Code YAML of file and, unless
+// dryRun, applies it.
+func ApplyCasc(server string, username string, password string, file string, dryRun bool) error {
+	configuration, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	err = CheckCasc(server, username, password, configuration)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Configuration %s is valid\n", file)
+
+	if dryRun {
+		return nil
+	}
+
+	data, status, err := postCasc(server, username, password, "apply", configuration)
+	if err != nil {
+		return err
+	}
+
+	if status != 200 {
+		return fmt.Errorf("Configuration couldn't be applied: %s", bytes.TrimSpace(data))
+	}
+
+	fmt.Printf("Configuration %s applied\n", file)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCascServer serves a configuration with a system message. Configurations
+// with unknown attributes fail the check.
+func newCascServer(t *testing.T) *testJenkinsServer {
+	return newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/configuration-as-code/export": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("jenkins:\n  systemMessage: hello\n"))
+		},
+		"/configuration-as-code/check": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "abc", r.Header.Get("Jenkins-Crumb"))
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			if strings.Contains(string(body), "unknown") {
+				w.Write([]byte(`[{"line":2,"warning":"Invalid configuration elements for type: class jenkins.model.Jenkins : unknown.\nAvailable attributes : systemMessage"}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		},
+		"/configuration-as-code/apply": func(w http.ResponseWriter, r *http.Request) {},
+	})
+}
+
+func TestGetCascConfiguration(t *testing.T) {
+	server := newCascServer(t)
+	defer server.Close()
+
+	got, err := GetCascConfiguration(server.URL, "user", "password")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "jenkins:\n  systemMessage: hello\n", string(got))
+}
+
+func TestApplyCasc(t *testing.T) {
+	tests := []struct {
+		name          string
+		configuration string
+		dryRun        bool
+		wantApplied   []string
+		wantErr       bool
+	}{
+		{"apply", "jenkins:\n  systemMessage: hello\n", false, []string{"jenkins:\n  systemMessage: hello\n"}, false},
+		{"dry run", "jenkins:\n  systemMessage: hello\n", true, nil, false},
+		{"invalid", "jenkins:\n  unknown: true\n", false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCascServer(t)
+			defer server.Close()
+			file, _ := ioutil.TempFile("", "jenkins.yaml")
+			defer os.Remove(file.Name())
+			file.WriteString(tt.configuration)
+			file.Close()
+
+			err := ApplyCasc(server.URL, "user", "password", file.Name(), tt.dryRun)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ApplyCasc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var applied []string
+			for _, request := range server.Requests("/configuration-as-code/apply") {
+				applied = append(applied, request.Body)
+			}
+			assert.Equal(t, tt.wantApplied, applied)
+		})
+	}
+}
+
+func TestGetCascConfiguration_PluginMissing(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := GetCascConfiguration(server.URL, "user", "password")
+
+	assert.EqualError(t, err, "Configuration as Code plugin not found 404")
+}
+
+func TestCheckCasc(t *testing.T) {
+	server := newCascServer(t)
+	defer server.Close()
+
+	err := CheckCasc(server.URL, "user", "password", []byte("jenkins:\n  systemMessage: hello\n"))
+	assert.Nil(t, err)
+
+	err = CheckCasc(server.URL, "user", "password", []byte("jenkins:\n  unknown: true\n"))
+	assert.EqualError(t, err, "Configuration is invalid: line 2: Invalid configuration elements for type: class jenkins.model.Jenkins : unknown.\nAvailable attributes : systemMessage")
+}
@@ -1,32 +1,503 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
+	neturl "net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
 )
 
-func DecryptFolderCredentials(url string, folderName string, username string, password string) error {
-	folder, _ := GetFolder(url, folderName, username, password)
-	credentials := folder.GetCredentials()
-	script := GetDecryptScriptForCredentials(credentials)
-	response := ExecuteGroovyScriptOnJenkins(script, url, username, password)
-	fmt.Println(response)
-	return nil
+// CredentialsBundle is the document produced by decrypt and consumed by
+// apply, holding the credentials grouped by domain.
+type CredentialsBundle struct {
+	Domains []DomainCredentials `json:"domains"`
 }
 
-func ApplyFolderCredentials(url string, folderName string, username string, password string) error {
+// ParseCredentialsBundle reads a credentials bundle. Documents without
+// domains, as written by earlier versions, are put into the global domain.
+func ParseCredentialsBundle(data []byte) (CredentialsBundle, error) {
+	var document map[string]json.RawMessage
+	err := json.Unmarshal(data, &document)
+	if err != nil {
+		return CredentialsBundle{}, err
+	}
+
+	var bundle CredentialsBundle
+	if _, ok := document["domains"]; ok {
+		err = json.Unmarshal(data, &bundle)
+		return bundle, err
+	}
+
 	var credentials Credentials
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return CredentialsBundle{}, err
+	}
+	bundle.Domains = []DomainCredentials{{Credentials: credentials}}
+	return bundle, nil
+}
+
+// AppliedCredentials is the result of the apply script per domain.
+type AppliedCredentials struct {
+	Domain string   `json:"domain"`
+	IDs    []string `json:"ids"`
+}
+
+func DecryptFolderCredentials(url string, folderName string, username string, password string, out io.Writer) error {
+	bundle, err := GetDecryptedFolderCredentials(url, folderName, username, password)
+	if err != nil {
+		return err
+	}
+	return writeCredentialsBundle(out, bundle)
+}
+
+func DecryptSystemCredentials(url string, username string, password string, out io.Writer) error {
+	var result struct {
+		CredentialsBundle
+		Unsupported []UnsupportedCredential `json:"unsupported"`
+	}
+	err := ExecuteGroovyScriptForResult(GetDecryptScriptForSystemCredentials(), url, username, password, &result)
+	if err != nil {
+		return fmt.Errorf("Global credentials cannot be decrypted: %v", err)
+	}
+	warnUnsupportedCredentials("", result.Unsupported)
+	return writeCredentialsBundle(out, result.CredentialsBundle)
+}
+
+// warnUnsupportedCredentials reports the credentials left out of an export
+// because their type is not supported.
+func warnUnsupportedCredentials(folderName string, credentials []UnsupportedCredential) {
+	for _, credential := range credentials {
+		fmt.Fprintf(os.Stderr, "Skipping credential %s of %s, type %s is not supported\n", credential.ID, storeName(folderName), credential.GetType())
+	}
+}
 
-	err := json.NewDecoder(os.Stdin).Decode(&credentials)
+func writeCredentialsBundle(out io.Writer, bundle CredentialsBundle) error {
+	data, err := json.Marshal(bundle)
 	if err != nil {
-		log.Fatal(err)
-		panic(err)
+		return err
 	}
-	script := GetApplyScriptForCredentials(credentials, folderName)
-	response := ExecuteGroovyScriptOnJenkins(script, url, username, password)
-	fmt.Println(response)
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
 
+// ApplyFolderCredentials reads credentials from in and creates or updates
+// them in the given folder, or in the global store if folderName is empty.
+func ApplyFolderCredentials(url string, folderName string, username string, password string, in io.Reader, mapping map[string]string) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := ParseCredentialsBundle(data)
+	if err != nil {
+		return fmt.Errorf("Credentials cannot be read: %v", err)
+	}
+	bundle.RenameIDs(mapping)
+	return applyCredentialsBundle(url, folderName, username, password, bundle)
+}
+
+func applyCredentialsBundle(url string, folderName string, username string, password string, bundle CredentialsBundle) error {
+	var applied []AppliedCredentials
+	err := ExecuteGroovyScriptForResult(GetApplyScriptForCredentials(bundle, folderName), url, username, password, &applied)
+	if err != nil {
+		return fmt.Errorf("Credentials cannot be applied to %s: %v", storeName(folderName), err)
+	}
+
+	for _, result := range applied {
+		domain := result.Domain
+		if domain == "" {
+			domain = "global"
+		}
+		fmt.Printf("Applied %d credentials to %s (domain %s): %s\n", len(result.IDs), storeName(folderName), domain, strings.Join(result.IDs, ", "))
+	}
 	return nil
 }
+
+func storeName(folderName string) string {
+	if folderName == "" {
+		return "global store"
+	}
+	return folderName
+}
+
+func GetDecryptedFolderCredentials(url string, folderName string, username string, password string) (CredentialsBundle, error) {
+	folder, err := GetFolder(url, folderName, username, password)
+	if err != nil {
+		return CredentialsBundle{}, err
+	}
+	for _, entry := range folder.GetDomainCredentials() {
+		warnUnsupportedCredentials(folderName, entry.Credentials.Unsupported)
+	}
+	if len(folder.GetDomainCredentials()) == 0 {
+		return CredentialsBundle{Domains: []DomainCredentials{}}, nil
+	}
+
+	var bundle CredentialsBundle
+	script := GetDecryptScriptForCredentials(CredentialsBundle{Domains: folder.GetDomainCredentials()})
+	err = ExecuteGroovyScriptForResult(script, url, username, password, &bundle)
+	if err != nil {
+		return CredentialsBundle{}, fmt.Errorf("Credentials of %s cannot be decrypted: %v", folderName, err)
+	}
+	return bundle, nil
+}
+
+// getFolderNamesRecursively returns the full names of the given folder and
+// of all folders below it.
+func getFolderNamesRecursively(url string, folderName string, username string, password string) ([]string, error) {
+	httpClient := &JenkinsHTTPClient{
+		BasicAuthSettings: BasicAuthSettings{
+			Username: username,
+			Password: password,
+		},
+	}
+	rootJob := NewJob(url, folderName, httpClient)
+	jobsList, err := rootJob.GetJobs()
+	if err != nil {
+		return []string{}, err
+	}
+
+	jobsList, err = jobsList.GetSubfoldersRecursively()
+	if err != nil {
+		return []string{}, err
+	}
+
+	folderNames := make([]string, 0, len(jobsList.Jobs)+1)
+	if folderName != "" {
+		folderNames = append(folderNames, strings.Trim(folderName, "/"))
+	}
+	for _, folder := range jobsList.Jobs {
+		name, err := neturl.PathUnescape(folder.GetFolderName())
+		if err != nil {
+			return []string{}, err
+		}
+		folderNames = append(folderNames, name)
+	}
+	sort.Strings(folderNames)
+	return folderNames, nil
+}
+
+// DecryptFolderCredentialsRecursively prints one document with the credentials
+// of every folder below folderName, keyed by the folder's full name.
+func DecryptFolderCredentialsRecursively(url string, folderName string, username string, password string, out io.Writer) error {
+	folderNames, err := getFolderNamesRecursively(url, folderName, username, password)
+	if err != nil {
+		return err
+	}
+
+	bundles := make(map[string]CredentialsBundle)
+	for _, name := range folderNames {
+		fmt.Fprintf(os.Stderr, "Decrypting credentials of %s\n", name)
+		bundle, err := GetDecryptedFolderCredentials(url, name, username, password)
+		if err != nil {
+			return err
+		}
+		if len(bundle.Domains) > 0 {
+			bundles[name] = bundle
+		}
+	}
+
+	data, err := json.Marshal(bundles)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(data))
+	return nil
+}
+
+// ApplyFolderCredentialsRecursively reads a document written by
+// DecryptFolderCredentialsRecursively from in and applies the credentials
+// to each folder. A folderName limits it to that folder and the ones below.
+func ApplyFolderCredentialsRecursively(url string, folderName string, username string, password string, in io.Reader, mapping map[string]string) error {
+	var document map[string]json.RawMessage
+	err := json.NewDecoder(in).Decode(&document)
+	if err != nil {
+		return err
+	}
+
+	folderName = strings.Trim(folderName, "/")
+	folderNames := make([]string, 0, len(document))
+	for name := range document {
+		if folderName == "" || name == folderName || strings.HasPrefix(name, folderName+"/") {
+			folderNames = append(folderNames, name)
+		}
+	}
+	sort.Strings(folderNames)
+
+	for _, name := range folderNames {
+		bundle, err := ParseCredentialsBundle(document[name])
+		if err != nil {
+			return fmt.Errorf("Credentials of %s cannot be read: %v", name, err)
+		}
+		bundle.RenameIDs(mapping)
+		err = applyCredentialsBundle(url, name, username, password, bundle)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isTerminal returns whether the file is a terminal rather than a pipe or a
+// regular file.
+var isTerminal = func(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// OpenCredentialsOutput returns where decrypted credentials are written to:
+// the given file or STDOUT, encrypted if recipients or a passphrase are given.
+// Encrypted output on STDOUT is armored, so only ciphertext hits the terminal.
+// Plaintext is only written to a terminal with plaintext set.
+func OpenCredentialsOutput(path string, recipients []string, passphrase string, plaintext bool) (io.WriteCloser, error) {
+	if path == "" {
+		if len(recipients) == 0 && passphrase == "" && !plaintext && isTerminal(os.Stdout) {
+			return nil, errors.New("Refusing to print plaintext credentials to a terminal, use --output, --encrypt-to, --passphrase or --plaintext")
+		}
+		return NewBundleWriter(os.Stdout, recipients, passphrase, true)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewBundleWriter(file, recipients, passphrase, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &bundleWriter{Writer: writer, closers: []io.Closer{writer, file}}, nil
+}
+
+// OpenCredentialsInput returns the plaintext of the given file or STDIN,
+// decrypting it transparently if it is age encrypted.
+func OpenCredentialsInput(path string, identityFiles []string, passphrase string) (io.Reader, error) {
+	var in io.Reader = os.Stdin
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(data)
+	}
+	return OpenBundleReader(in, identityFiles, passphrase)
+}
+
+// CredentialInfo describes a credential without any of its secrets.
+type CredentialInfo struct {
+	Folder      string `json:"folder"`
+	Domain      string `json:"domain"`
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+func (credentials *Credentials) GetInfos(folder string, domain string) []CredentialInfo {
+	infos := make([]CredentialInfo, 0)
+	add := func(credentialType string, id string, scope string, description string) {
+		infos = append(infos, CredentialInfo{Folder: folder, Domain: domain, ID: id, Type: credentialType, Scope: scope, Description: description})
+	}
+	for _, c := range credentials.UsernamePassword {
+		add("Username with password", c.ID, c.Scope, c.Description)
+	}
+	for _, c := range credentials.SecretFile {
+		add("Secret file", c.ID, c.Scope, c.Description)
+	}
+	for _, c := range credentials.SecretText {
+		add("Secret text", c.ID, c.Scope, c.Description)
+	}
+	for _, c := range credentials.SSHPrivateKey {
+		add("SSH Username with private key", c.ID, c.Scope, c.Description)
+	}
+	for _, c := range credentials.Certificate {
+		add("Certificate", c.ID, c.Scope, c.Description)
+	}
+	for _, c := range credentials.GitHubApp {
+		add("GitHub App", c.ID, c.Scope, c.Description)
+	}
+	return infos
+}
+
+func GetFolderCredentialInfos(url string, folderName string, username string, password string) ([]CredentialInfo, error) {
+	folder, err := GetFolder(url, folderName, username, password)
+	if err != nil {
+		return []CredentialInfo{}, err
+	}
+
+	infos := make([]CredentialInfo, 0)
+	for _, entry := range folder.GetDomainCredentials() {
+		infos = append(infos, entry.Credentials.GetInfos(folderName, entry.Domain.Name)...)
+	}
+	return infos, nil
+}
+
+func GetSystemCredentialInfos(url string, username string, password string) ([]CredentialInfo, error) {
+	var infos []CredentialInfo
+	err := ExecuteGroovyScriptForResult(listSystemCredentialsScript, url, username, password, &infos)
+	if err != nil {
+		return []CredentialInfo{}, fmt.Errorf("Credentials cannot be listed: %v", err)
+	}
+	return infos, nil
+}
+
+// ListCredentials prints the credentials of a folder, or of the global store
+// without folder. Secrets are never read: folders are listed from their
+// config.xml and the global store with a metadata-only script.
+func ListCredentials(url string, folderName string, username string, password string, recursive bool, format string) error {
+	var infos []CredentialInfo
+	var err error
+
+	if folderName == "" {
+		infos, err = GetSystemCredentialInfos(url, username, password)
+	} else {
+		infos, err = GetFolderCredentialInfos(url, folderName, username, password)
+	}
+	if err != nil {
+		return err
+	}
+
+	if recursive {
+		folderNames, err := getFolderNamesRecursively(url, folderName, username, password)
+		if err != nil {
+			return err
+		}
+		for _, name := range folderNames {
+			if name == strings.Trim(folderName, "/") {
+				continue
+			}
+			folderInfos, err := GetFolderCredentialInfos(url, name, username, password)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, folderInfos...)
+		}
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "table", "":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Folder", "Domain", "ID", "Type", "Scope", "Description"})
+		for _, info := range infos {
+			folder := info.Folder
+			if folder == "" {
+				folder = "(global)"
+			}
+			domain := info.Domain
+			if domain == "" {
+				domain = "(global)"
+			}
+			table.Append([]string{folder, domain, info.ID, info.Type, info.Scope, info.Description})
+		}
+		table.Render()
+	default:
+		return fmt.Errorf("Unknown format %q, expected table or json", format)
+	}
+	return nil
+}
+
+// ParseCredentialsMapping reads old-id=new-id pairs and an optional YAML
+// file mapping old IDs to new IDs. Pairs take precedence over the file.
+func ParseCredentialsMapping(pairs []string, mappingFile string) (map[string]string, error) {
+	mapping := make(map[string]string)
+
+	if mappingFile != "" {
+		data, err := ioutil.ReadFile(mappingFile)
+		if err != nil {
+			return mapping, err
+		}
+		err = yaml.Unmarshal(data, &mapping)
+		if err != nil {
+			return mapping, fmt.Errorf("%s: %v", mappingFile, err)
+		}
+	}
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return mapping, fmt.Errorf("Invalid mapping %q, expected old-id=new-id", pair)
+		}
+		mapping[parts[0]] = parts[1]
+	}
+	return mapping, nil
+}
+
+func renameID(id *string, mapping map[string]string) {
+	if newID, ok := mapping[*id]; ok {
+		*id = newID
+	}
+}
+
+func (credentials *Credentials) RenameIDs(mapping map[string]string) {
+	for i := range credentials.UsernamePassword {
+		renameID(&credentials.UsernamePassword[i].ID, mapping)
+	}
+	for i := range credentials.SecretFile {
+		renameID(&credentials.SecretFile[i].ID, mapping)
+	}
+	for i := range credentials.SecretText {
+		renameID(&credentials.SecretText[i].ID, mapping)
+	}
+	for i := range credentials.SSHPrivateKey {
+		renameID(&credentials.SSHPrivateKey[i].ID, mapping)
+	}
+	for i := range credentials.Certificate {
+		renameID(&credentials.Certificate[i].ID, mapping)
+	}
+	for i := range credentials.GitHubApp {
+		renameID(&credentials.GitHubApp[i].ID, mapping)
+	}
+}
+
+func (bundle *CredentialsBundle) RenameIDs(mapping map[string]string) {
+	for i := range bundle.Domains {
+		bundle.Domains[i].Credentials.RenameIDs(mapping)
+	}
+}
+
+var (
+	credentialsIDElementPattern = regexp.MustCompile(`<([\w.-]*[cC]redentialsId)>([^<]*)</([\w.-]*[cC]redentialsId)>`)
+	credentialsIDScriptPattern  = regexp.MustCompile(`(credentialsId\s*:\s*)(&apos;|&quot;|'|")([^'"&<]*)(&apos;|&quot;|'|")`)
+)
+
+// RewriteCredentialReferences renames credential IDs referenced by a job
+// config, both in *credentialsId elements and in credentialsId arguments of
+// inline pipeline scripts.
+func RewriteCredentialReferences(config []byte, mapping map[string]string) []byte {
+	config = credentialsIDElementPattern.ReplaceAllFunc(config, func(match []byte) []byte {
+		groups := credentialsIDElementPattern.FindSubmatch(match)
+		newID, ok := mapping[strings.TrimSpace(string(groups[2]))]
+		if !ok || string(groups[1]) != string(groups[3]) {
+			return match
+		}
+		return []byte(fmt.Sprintf("<%s>%s</%s>", groups[1], escapeXMLString(newID), groups[1]))
+	})
+
+	return credentialsIDScriptPattern.ReplaceAllFunc(config, func(match []byte) []byte {
+		groups := credentialsIDScriptPattern.FindSubmatch(match)
+		newID, ok := mapping[string(groups[3])]
+		if !ok {
+			return match
+		}
+		// The ID ends up in a Groovy string literal inside the XML text
+		return []byte(fmt.Sprintf("%s%s%s%s", groups[1], groups[2], escapeXMLString(groovyStringEscaper.Replace(newID)), groups[4]))
+	})
+}
+
+var groovyStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`, "$", `\$`)
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCredentialsBundle(t *testing.T) {
+	assert := assert.New(t)
+
+	bundle, err := ParseCredentialsBundle([]byte(`{"domains":[{"domain":{"name":"artifactory","description":"","specifications":[]},"credentials":{"secrettext":[{"id":"token","secret":"s3cr3t"}]}}]}`))
+
+	assert.Nil(err)
+	assert.Len(bundle.Domains, 1)
+	assert.Equal("artifactory", bundle.Domains[0].Domain.Name)
+	assert.Equal("s3cr3t", bundle.Domains[0].Credentials.SecretText[0].Secret)
+}
+
+func TestParseCredentialsBundle_WithoutDomains(t *testing.T) {
+	assert := assert.New(t)
+
+	bundle, err := ParseCredentialsBundle([]byte(`{"userpass":[{"id":"test","username":"user","password":"pass"}],"secretfile":null}`))
+
+	assert.Nil(err)
+	assert.Len(bundle.Domains, 1)
+	assert.Equal("", bundle.Domains[0].Domain.Name)
+	assert.Equal("test", bundle.Domains[0].Credentials.UsernamePassword[0].ID)
+}
+
+func TestParseCredentialsBundle_Invalid(t *testing.T) {
+	_, err := ParseCredentialsBundle([]byte(`not json`))
+
+	assert.NotNil(t, err)
+}
+
+func TestCredentials_GetInfos(t *testing.T) {
+	credentials := Credentials{
+		UsernamePassword: []UsernamePasswordCredential{{ID: "user", Scope: "GLOBAL", Description: "Deploy user", Password: "{secret}"}},
+		SSHPrivateKey:    []SSHPrivateKeyCredential{{ID: "ssh", Scope: "SYSTEM", PrivateKey: "{secret}"}},
+	}
+
+	got := credentials.GetInfos("team/app", "artifactory")
+
+	assert.Equal(t, []CredentialInfo{
+		{Folder: "team/app", Domain: "artifactory", ID: "user", Type: "Username with password", Scope: "GLOBAL", Description: "Deploy user"},
+		{Folder: "team/app", Domain: "artifactory", ID: "ssh", Type: "SSH Username with private key", Scope: "SYSTEM"},
+	}, got)
+}
+
+func TestParseCredentialsMapping(t *testing.T) {
+	assert := assert.New(t)
+	file, _ := ioutil.TempFile("", "mapping*.yaml")
+	file.WriteString("deploy: team-a-deploy\ntoken: team-a-token\n")
+	file.Close()
+	defer os.Remove(file.Name())
+
+	mapping, err := ParseCredentialsMapping([]string{"token=override", "ssh=team-a-ssh"}, file.Name())
+
+	assert.Nil(err)
+	assert.Equal(map[string]string{"deploy": "team-a-deploy", "token": "override", "ssh": "team-a-ssh"}, mapping)
+
+	_, err = ParseCredentialsMapping([]string{"no-equal-sign"}, "")
+	assert.NotNil(err)
+}
+
+func TestCredentialsBundle_RenameIDs(t *testing.T) {
+	bundle := CredentialsBundle{Domains: []DomainCredentials{{Credentials: Credentials{
+		UsernamePassword: []UsernamePasswordCredential{{ID: "deploy"}, {ID: "other"}},
+		GitHubApp:        []GitHubAppCredential{{ID: "app"}},
+	}}}}
+
+	bundle.RenameIDs(map[string]string{"deploy": "team-a-deploy", "app": "team-a-app"})
+
+	assert.Equal(t, "team-a-deploy", bundle.Domains[0].Credentials.UsernamePassword[0].ID)
+	assert.Equal(t, "other", bundle.Domains[0].Credentials.UsernamePassword[1].ID)
+	assert.Equal(t, "team-a-app", bundle.Domains[0].Credentials.GitHubApp[0].ID)
+}
+
+func TestRewriteCredentialReferences(t *testing.T) {
+	config := `<flow-definition plugin="workflow-job@2.40">
+  <scm class="hudson.plugins.git.GitSCM">
+    <userRemoteConfigs>
+      <hudson.plugins.git.UserRemoteConfig>
+        <credentialsId>deploy</credentialsId>
+      </hudson.plugins.git.UserRemoteConfig>
+    </userRemoteConfigs>
+  </scm>
+  <scanCredentialsId>deploy-other</scanCredentialsId>
+  <script>withCredentials([string(credentialsId: &apos;deploy&apos;, variable: &apos;TOKEN&apos;)]) {
+  git credentialsId: &quot;deploy&quot;, url: &apos;https://example.com/repo.git&apos;
+}</script>
+</flow-definition>`
+	want := `<flow-definition plugin="workflow-job@2.40">
+  <scm class="hudson.plugins.git.GitSCM">
+    <userRemoteConfigs>
+      <hudson.plugins.git.UserRemoteConfig>
+        <credentialsId>team-a-deploy</credentialsId>
+      </hudson.plugins.git.UserRemoteConfig>
+    </userRemoteConfigs>
+  </scm>
+  <scanCredentialsId>deploy-other</scanCredentialsId>
+  <script>withCredentials([string(credentialsId: &apos;team-a-deploy&apos;, variable: &apos;TOKEN&apos;)]) {
+  git credentialsId: &quot;team-a-deploy&quot;, url: &apos;https://example.com/repo.git&apos;
+}</script>
+</flow-definition>`
+
+	got := RewriteCredentialReferences([]byte(config), map[string]string{"deploy": "team-a-deploy"})
+
+	assert.Equal(t, want, string(got))
+}
+
+func TestRewriteCredentialReferences_Escaped(t *testing.T) {
+	config := `<flow-definition>
+  <credentialsId>deploy</credentialsId>
+  <script>git credentialsId: &apos;deploy&apos;, url: &apos;https://example.com/repo.git&apos;</script>
+</flow-definition>`
+	want := `<flow-definition>
+  <credentialsId>a&lt;b&gt;&amp;&apos;c</credentialsId>
+  <script>git credentialsId: &apos;a&lt;b&gt;&amp;\&apos;c&apos;, url: &apos;https://example.com/repo.git&apos;</script>
+</flow-definition>`
+
+	got := RewriteCredentialReferences([]byte(config), map[string]string{"deploy": "a<b>&'c"})
+
+	assert.Equal(t, want, string(got))
+}
+
+const folderWithCredentialsConfig = `<?xml version='1.1' encoding='UTF-8'?>
+<com.cloudbees.hudson.plugins.folder.Folder plugin="cloudbees-folder@6.15">
+  <properties>
+    <com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+      <domainCredentialsMap class="hudson.util.CopyOnWriteMap$Hash">
+        <entry>
+          <com.cloudbees.plugins.credentials.domains.Domain>
+            <specifications/>
+          </com.cloudbees.plugins.credentials.domains.Domain>
+          <java.util.concurrent.CopyOnWriteArrayList>
+            <com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl plugin="credentials@2.3.14">
+              <id>deploy</id>
+              <username>deployer</username>
+              <password>{AQAAABAAAAAQ7EzV5N/fXZEKM9HyG+1T66P67iqU+tptVCNuvNX1TM0=}</password>
+            </com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl>
+          </java.util.concurrent.CopyOnWriteArrayList>
+        </entry>
+      </domainCredentialsMap>
+    </com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+  </properties>
+</com.cloudbees.hudson.plugins.folder.Folder>`
+
+// newCredentialsServer fakes a Jenkins with the folder team, which has
+// credentials, and the nested folder team/empty, which has none. Scripts
+// decrypt a password by prefixing it with "plain:".
+func newCredentialsServer(t *testing.T) *testJenkinsServer {
+	folder := `<job _class="com.cloudbees.hudson.plugins.folder.Folder"><name>%s</name><url>http://%s/job/%s/</url></job>`
+	return newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/api/xml": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `<hudson>`+folder+`<job _class="org.jenkinsci.plugins.workflow.job.WorkflowJob"><name>app</name><url>http://%s/job/app/</url></job></hudson>`, "team", r.Host, "team", r.Host)
+		},
+		"/job/team/api/xml": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `<com.cloudbees.hudson.plugins.folder.Folder>`+folder+`</com.cloudbees.hudson.plugins.folder.Folder>`, "empty", r.Host, "team/job/empty")
+		},
+		"/job/team/job/empty/api/xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<com.cloudbees.hudson.plugins.folder.Folder/>`))
+		},
+		"/job/team/config.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(folderWithCredentialsConfig))
+		},
+		"/job/team/job/empty/config.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<com.cloudbees.hudson.plugins.folder.Folder/>`))
+		},
+		"/scriptText": func(w http.ResponseWriter, r *http.Request) {
+			values := decodedGroovyStrings(t, r.FormValue("script"))
+			var bundle CredentialsBundle
+			if err := json.Unmarshal([]byte(values[0]), &bundle); err != nil {
+				t.Fatal(err)
+			}
+			var result interface{} = bundle
+			if len(values) == 1 {
+				for _, domain := range bundle.Domains {
+					for i := range domain.Credentials.UsernamePassword {
+						domain.Credentials.UsernamePassword[i].Password = "plain:" + domain.Credentials.UsernamePassword[i].Password
+					}
+				}
+			} else {
+				ids := []string{}
+				for _, domain := range bundle.Domains {
+					for _, credential := range domain.Credentials.UsernamePassword {
+						ids = append(ids, credential.ID)
+					}
+				}
+				result = []AppliedCredentials{{IDs: ids}}
+			}
+			data, _ := json.Marshal(result)
+			fmt.Fprintf(w, "BUTLER_RESULT:%s\n", data)
+		},
+	})
+}
+
+// appliedFolders returns the folders credentials were applied to. The
+// decrypt script only embeds the credentials, the apply script also the
+// folder.
+func appliedFolders(t *testing.T, server *testJenkinsServer) []string {
+	folders := []string{}
+	for _, request := range server.Requests("/scriptText") {
+		values := decodedGroovyStrings(t, request.Form.Get("script"))
+		if len(values) > 1 {
+			folders = append(folders, values[1])
+		}
+	}
+	return folders
+}
+
+func TestDecryptFolderCredentialsRecursively(t *testing.T) {
+	assert := assert.New(t)
+	server := newCredentialsServer(t)
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := DecryptFolderCredentialsRecursively(server.URL, "", "user", "password", &out)
+
+	assert.Nil(err)
+	var bundles map[string]CredentialsBundle
+	assert.Nil(json.Unmarshal(out.Bytes(), &bundles))
+	assert.Len(bundles, 1, "folders without credentials are left out")
+	assert.Equal("deploy", bundles["team"].Domains[0].Credentials.UsernamePassword[0].ID)
+	assert.Equal("plain:{AQAAABAAAAAQ7EzV5N/fXZEKM9HyG+1T66P67iqU+tptVCNuvNX1TM0=}", bundles["team"].Domains[0].Credentials.UsernamePassword[0].Password)
+}
+
+func TestDecryptFolderCredentialsRecursively_WithoutCredentials(t *testing.T) {
+	server := newCredentialsServer(t)
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := DecryptFolderCredentialsRecursively(server.URL, "team/empty", "user", "password", &out)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "{}\n", out.String())
+}
+
+func TestApplyFolderCredentialsRecursively(t *testing.T) {
+	tests := []struct {
+		name       string
+		folderName string
+		want       []string
+	}{
+		{"All folders", "", []string{"other", "team", "team/sub"}},
+		{"Nested folders", "team", []string{"team", "team/sub"}},
+		{"Single folder", "team/sub", []string{"team/sub"}},
+		{"Folder without credentials", "empty", []string{}},
+	}
+	document := `{
+		"team/sub": {"domains":[{"domain":{},"credentials":{"userpass":[{"id":"deploy","password":"s3cr3t"}]}}]},
+		"team": {"domains":[{"domain":{},"credentials":{"userpass":[{"id":"app","password":"s3cr3t"}]}}]},
+		"other": {"userpass":[{"id":"other","password":"s3cr3t"}]}
+	}`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCredentialsServer(t)
+			defer server.Close()
+
+			err := ApplyFolderCredentialsRecursively(server.URL, tt.folderName, "user", "password", strings.NewReader(document), nil)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, appliedFolders(t, server))
+		})
+	}
+}
+
+func TestOpenCredentialsOutput_Terminal(t *testing.T) {
+	stdoutIsTerminal := isTerminal
+	isTerminal = func(file *os.File) bool { return true }
+	defer func() { isTerminal = stdoutIsTerminal }()
+
+	_, err := OpenCredentialsOutput("", nil, "", false)
+	assert.EqualError(t, err, "Refusing to print plaintext credentials to a terminal, use --output, --encrypt-to, --passphrase or --plaintext")
+
+	out, err := OpenCredentialsOutput("", nil, "", true)
+	assert.Nil(t, err)
+	assert.NotNil(t, out)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const ageHeader = "age-encryption.org/v1"
+
+type bundleWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// Close flushes the encryption layers, innermost first.
+func (writer *bundleWriter) Close() error {
+	for _, closer := range writer.closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRecipients(recipients []string, passphrase string) ([]age.Recipient, error) {
+	parsed := make([]age.Recipient, 0, len(recipients)+1)
+	for _, recipient := range recipients {
+		x25519Recipient, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return []age.Recipient{}, err
+		}
+		parsed = append(parsed, x25519Recipient)
+	}
+
+	if passphrase != "" {
+		if len(parsed) > 0 {
+			return []age.Recipient{}, errors.New("A passphrase cannot be combined with recipients")
+		}
+		scryptRecipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return []age.Recipient{}, err
+		}
+		parsed = append(parsed, scryptRecipient)
+	}
+	return parsed, nil
+}
+
+// NewBundleWriter encrypts everything written to it for the given age
+// recipients or passphrase. Without either, it writes plaintext. The
+// returned writer must be closed to flush the ciphertext.
+func NewBundleWriter(out io.Writer, recipients []string, passphrase string, armored bool) (io.WriteCloser, error) {
+	parsed, err := parseRecipients(recipients, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed) == 0 {
+		return &bundleWriter{Writer: out}, nil
+	}
+
+	writer := &bundleWriter{}
+	if armored {
+		armorWriter := armor.NewWriter(out)
+		writer.closers = append(writer.closers, armorWriter)
+		out = armorWriter
+	}
+
+	encryptWriter, err := age.Encrypt(out, parsed...)
+	if err != nil {
+		return nil, err
+	}
+	writer.Writer = encryptWriter
+	writer.closers = append([]io.Closer{encryptWriter}, writer.closers...)
+	return writer, nil
+}
+
+func readIdentities(identityFiles []string, passphrase string) ([]age.Identity, error) {
+	identities := make([]age.Identity, 0, len(identityFiles)+1)
+	for _, identityFile := range identityFiles {
+		file, err := os.Open(identityFile)
+		if err != nil {
+			return []age.Identity{}, err
+		}
+		parsed, err := age.ParseIdentities(file)
+		file.Close()
+		if err != nil {
+			return []age.Identity{}, fmt.Errorf("%s: %v", identityFile, err)
+		}
+		identities = append(identities, parsed...)
+	}
+
+	if passphrase != "" {
+		scryptIdentity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return []age.Identity{}, err
+		}
+		identities = append(identities, scryptIdentity)
+	}
+	return identities, nil
+}
+
+// OpenBundleReader returns the plaintext of an age encrypted (binary or
+// armored) bundle. Unencrypted input is passed through as is.
+func OpenBundleReader(in io.Reader, identityFiles []string, passphrase string) (io.Reader, error) {
+	buffered := bufio.NewReader(in)
+	start, _ := buffered.Peek(len(armor.Header))
+
+	var encrypted io.Reader
+	switch {
+	case bytes.HasPrefix(start, []byte(armor.Header)):
+		encrypted = armor.NewReader(buffered)
+	case bytes.HasPrefix(start, []byte(ageHeader)):
+		encrypted = buffered
+	default:
+		return buffered, nil
+	}
+
+	identities, err := readIdentities(identityFiles, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("Credentials are encrypted, provide --identity or --passphrase")
+	}
+
+	return age.Decrypt(encrypted, identities...)
+}
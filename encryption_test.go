@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBundle = `{"domains":[{"domain":{"name":""},"credentials":{"secrettext":[{"id":"token","secret":"s3cr3t"}]}}]}`
+
+func encryptTestBundle(t *testing.T, recipients []string, passphrase string, armored bool) []byte {
+	var out bytes.Buffer
+	writer, err := NewBundleWriter(&out, recipients, passphrase, armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte(testBundle))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestBundleEncryption_X25519(t *testing.T) {
+	assert := assert.New(t)
+	identity, _ := age.GenerateX25519Identity()
+	identityFile, _ := ioutil.TempFile("", "identity")
+	identityFile.WriteString("# test identity\n" + identity.String() + "\n")
+	identityFile.Close()
+	defer os.Remove(identityFile.Name())
+
+	for _, armored := range []bool{false, true} {
+		ciphertext := encryptTestBundle(t, []string{identity.Recipient().String()}, "", armored)
+		assert.NotContains(string(ciphertext), "s3cr3t")
+		assert.Equal(armored, strings.HasPrefix(string(ciphertext), armor.Header))
+
+		reader, err := OpenBundleReader(bytes.NewReader(ciphertext), []string{identityFile.Name()}, "")
+		assert.Nil(err)
+		plaintext, _ := ioutil.ReadAll(reader)
+		assert.Equal(testBundle, string(plaintext))
+	}
+}
+
+func TestBundleEncryption_Passphrase(t *testing.T) {
+	assert := assert.New(t)
+	ciphertext := encryptTestBundle(t, []string{}, "correct horse battery staple", false)
+
+	_, err := OpenBundleReader(bytes.NewReader(ciphertext), []string{}, "")
+	assert.NotNil(err)
+
+	reader, err := OpenBundleReader(bytes.NewReader(ciphertext), []string{}, "correct horse battery staple")
+	assert.Nil(err)
+	plaintext, _ := ioutil.ReadAll(reader)
+	assert.Equal(testBundle, string(plaintext))
+}
+
+func TestBundleEncryption_Plaintext(t *testing.T) {
+	assert := assert.New(t)
+	plaintext := encryptTestBundle(t, []string{}, "", false)
+	assert.Equal(testBundle, string(plaintext))
+
+	reader, err := OpenBundleReader(bytes.NewReader(plaintext), []string{}, "")
+	assert.Nil(err)
+	read, _ := ioutil.ReadAll(reader)
+	assert.Equal(testBundle, string(read))
+}
+
+func TestBundleEncryption_PassphraseAndRecipients(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+
+	_, err := NewBundleWriter(&bytes.Buffer{}, []string{identity.Recipient().String()}, "secret", false)
+
+	assert.NotNil(t, err)
+}
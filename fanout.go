@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
+)
+
+// ServerProfile is a Jenkins controller as configured in the config file.
+type ServerProfile struct {
+	URL         string `yaml:"url"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"passwordEnv"`
+}
+
+// Config is the butler config file, e.g.
+//
+//	servers:
+//	  prod-1:
+//	    url: https://jenkins1.example.com
+//	    username: admin
+//	    passwordEnv: PROD_1_TOKEN
+//	groups:
+//	  prod: [prod-1, prod-2]
+type Config struct {
+	Servers map[string]ServerProfile `yaml:"servers"`
+	Groups  map[string][]string      `yaml:"groups"`
+}
+
+type FanOutTarget struct {
+	Name    string
+	Profile ServerProfile
+}
+
+type FanOutResult struct {
+	Target   FanOutTarget
+	ExitCode int
+	Duration time.Duration
+}
+
+// fanOutChildEnv is set for the runs of a fan-out, which must not fan out
+// again.
+const fanOutChildEnv = "BUTLER_FANOUT_CHILD"
+
+func IsFanOutChild() bool {
+	return os.Getenv(fanOutChildEnv) != ""
+}
+
+func getDefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".butler.yaml"
+	}
+	return filepath.Join(home, ".butler.yaml")
+}
+
+// LoadConfig reads the config file, a missing file is an empty config.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// ResolveTargets returns the controllers of a comma separated list of
+// servers, which are either names from the config or urls, and of a
+// profile group.
+func ResolveTargets(config Config, servers string, group string) ([]FanOutTarget, error) {
+	targets := make([]FanOutTarget, 0)
+	seen := make(map[string]bool)
+	add := func(name string, profile ServerProfile) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		profile.URL = getSanitizedUrl(profile.URL)
+		if profile.PasswordEnv != "" {
+			profile.Password = os.Getenv(profile.PasswordEnv)
+		}
+		targets = append(targets, FanOutTarget{Name: name, Profile: profile})
+	}
+
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		profile, ok := config.Servers[server]
+		if !ok {
+			profile = ServerProfile{URL: server}
+		}
+		add(server, profile)
+	}
+
+	if group != "" {
+		members, ok := config.Groups[group]
+		if !ok {
+			return []FanOutTarget{}, fmt.Errorf("Unknown profile group %q", group)
+		}
+		for _, member := range members {
+			profile, ok := config.Servers[member]
+			if !ok {
+				return []FanOutTarget{}, fmt.Errorf("Server %q of profile group %q is not configured", member, group)
+			}
+			add(member, profile)
+		}
+	}
+
+	return targets, nil
+}
+
+// prefixWriter prefixes every line written to it, so the output of
+// concurrently running commands stays readable.
+type prefixWriter struct {
+	prefix string
+	dst    io.Writer
+	mutex  *sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (writer *prefixWriter) Write(p []byte) (int, error) {
+	writer.buffer.Write(p)
+	for {
+		line, err := writer.buffer.ReadBytes('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			writer.buffer.Reset()
+			writer.buffer.Write(line)
+			return len(p), nil
+		}
+		writer.mutex.Lock()
+		_, err = fmt.Fprintf(writer.dst, "%s%s", writer.prefix, line)
+		writer.mutex.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (writer *prefixWriter) Flush() {
+	if writer.buffer.Len() > 0 {
+		writer.Write([]byte("\n"))
+	}
+}
+
+// FanOut runs butler with args once per target, concurrently, and returns the
+// combined exit code. With perServerDir every run works in a directory named
+// after its target, so exports do not overwrite each other.
+func FanOut(targets []FanOutTarget, args []string, perServerDir bool, parallel int) int {
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if parallel <= 0 || parallel > len(targets) {
+		parallel = len(targets)
+	}
+
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan bool, parallel)
+	results := make([]FanOutResult, len(targets))
+
+	for i, target := range targets {
+		wait.Add(1)
+		go func(i int, target FanOutTarget) {
+			defer wait.Done()
+			slots <- true
+			defer func() { <-slots }()
+
+			stdout := &prefixWriter{prefix: fmt.Sprintf("[%s] ", target.Name), dst: os.Stdout, mutex: &mutex}
+			stderr := &prefixWriter{prefix: fmt.Sprintf("[%s] ", target.Name), dst: os.Stderr, mutex: &mutex}
+
+			cmd := exec.Command(executable, args...)
+			cmd.Stdin = nil
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+			cmd.Env = getChildEnvironment(os.Environ(), target)
+
+			if perServerDir {
+				cmd.Dir = getServerFileName(target.Name)
+				if _, err := os.Stat(cmd.Dir); os.IsNotExist(err) {
+					os.MkdirAll(cmd.Dir, 0755)
+				}
+			}
+
+			start := time.Now()
+			err := cmd.Run()
+			stdout.Flush()
+			stderr.Flush()
+
+			exitCode := 0
+			if exitError, ok := err.(*exec.ExitError); ok {
+				exitCode = exitError.ExitCode()
+			} else if err != nil {
+				fmt.Fprintf(stderr, "%v\n", err)
+				exitCode = 1
+			}
+			results[i] = FanOutResult{Target: target, ExitCode: exitCode, Duration: time.Since(start)}
+		}(i, target)
+	}
+	wait.Wait()
+
+	return printFanOutSummary(results)
+}
+
+// getChildEnvironment returns the environment of the run for target. The
+// server list is left out and fanOutChildEnv set, so the run does not fan
+// out again.
+func getChildEnvironment(environ []string, target FanOutTarget) []string {
+	env := make([]string, 0, len(environ)+4)
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, "JENKINS_SERVERS=") {
+			env = append(env, variable)
+		}
+	}
+	env = append(env, fanOutChildEnv+"=1", "JENKINS_SERVER="+target.Profile.URL)
+	if target.Profile.Username != "" {
+		env = append(env, "JENKINS_USER="+target.Profile.Username)
+	}
+	if target.Profile.Password != "" {
+		env = append(env, "JENKINS_PASSWORD="+target.Profile.Password)
+	}
+	return env
+}
+
+func printFanOutSummary(results []FanOutResult) int {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Target.Name < results[j].Target.Name })
+
+	exitCode := 0
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Server", "Result", "Exit Code", "Duration"})
+	for _, result := range results {
+		status := "OK"
+		if result.ExitCode != 0 {
+			status = "FAILED"
+			exitCode = 1
+		}
+		table.Append([]string{result.Target.Name, status, fmt.Sprintf("%d", result.ExitCode), result.Duration.Round(time.Millisecond).String()})
+	}
+	table.Render()
+	return exitCode
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+	file, err := ioutil.TempFile("", "butler-config")
+	assert.Nil(err)
+	defer os.Remove(file.Name())
+	file.WriteString("servers:\n  prod-1:\n    url: jenkins1:8080\n    username: admin\n    passwordEnv: PROD_1_TOKEN\ngroups:\n  prod: [prod-1]\n")
+	file.Close()
+
+	config, err := LoadConfig(file.Name())
+	assert.Nil(err)
+	assert.Equal(ServerProfile{URL: "jenkins1:8080", Username: "admin", PasswordEnv: "PROD_1_TOKEN"}, config.Servers["prod-1"])
+	assert.Equal([]string{"prod-1"}, config.Groups["prod"])
+
+	config, err = LoadConfig(file.Name() + ".missing")
+	assert.Nil(err)
+	assert.Empty(config.Servers)
+}
+
+func TestResolveTargets(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("BUTLER_TEST_TOKEN", "secret")
+	defer os.Unsetenv("BUTLER_TEST_TOKEN")
+	config := Config{
+		Servers: map[string]ServerProfile{
+			"prod-1": {URL: "jenkins1:8080/", Username: "admin", PasswordEnv: "BUTLER_TEST_TOKEN"},
+			"prod-2": {URL: "https://jenkins2", Username: "admin", Password: "pass"},
+		},
+		Groups: map[string][]string{
+			"prod":   {"prod-1", "prod-2"},
+			"broken": {"prod-3"},
+		},
+	}
+
+	targets, err := ResolveTargets(config, "https://jenkins3/, prod-1", "prod")
+	assert.Nil(err)
+	assert.Equal([]FanOutTarget{
+		{Name: "https://jenkins3/", Profile: ServerProfile{URL: "https://jenkins3"}},
+		{Name: "prod-1", Profile: ServerProfile{URL: "http://jenkins1:8080", Username: "admin", Password: "secret", PasswordEnv: "BUTLER_TEST_TOKEN"}},
+		{Name: "prod-2", Profile: ServerProfile{URL: "https://jenkins2", Username: "admin", Password: "pass"}},
+	}, targets)
+
+	_, err = ResolveTargets(config, "", "staging")
+	assert.EqualError(err, `Unknown profile group "staging"`)
+
+	_, err = ResolveTargets(config, "", "broken")
+	assert.EqualError(err, `Server "prod-3" of profile group "broken" is not configured`)
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer := &prefixWriter{prefix: "[prod-1] ", dst: &out, mutex: &sync.Mutex{}}
+
+	writer.Write([]byte("first\nsec"))
+	writer.Write([]byte("ond\nthird"))
+	writer.Flush()
+
+	assert.Equal(t, "[prod-1] first\n[prod-1] second\n[prod-1] third\n", out.String())
+}
+
+func Test_getChildEnvironment(t *testing.T) {
+	target := FanOutTarget{Name: "prod-1", Profile: ServerProfile{URL: "http://jenkins1:8080", Username: "admin", Password: "secret"}}
+
+	got := getChildEnvironment([]string{"PATH=/bin", "JENKINS_SERVERS=prod-1,prod-2"}, target)
+
+	assert.Equal(t, []string{"PATH=/bin", "BUTLER_FANOUT_CHILD=1", "JENKINS_SERVER=http://jenkins1:8080", "JENKINS_USER=admin", "JENKINS_PASSWORD=secret"}, got)
+}
+
+// TestFanOut_ChildDoesNotFanOutAgain runs the test binary as the child of a
+// fan-out, see TestFanOutHelperProcess.
+func TestFanOut_ChildDoesNotFanOutAgain(t *testing.T) {
+	os.Setenv("JENKINS_SERVERS", "prod-1,prod-2")
+	os.Setenv("BUTLER_TEST_FANOUT_HELPER", "1")
+	defer os.Unsetenv("JENKINS_SERVERS")
+	defer os.Unsetenv("BUTLER_TEST_FANOUT_HELPER")
+	targets := []FanOutTarget{
+		{Name: "prod-1", Profile: ServerProfile{URL: "http://jenkins1:8080"}},
+		{Name: "prod-2", Profile: ServerProfile{URL: "http://jenkins2:8080"}},
+	}
+
+	exitCode := FanOut(targets, []string{"-test.run=^TestFanOutHelperProcess$"}, false, 0)
+
+	assert.Equal(t, 0, exitCode)
+}
+
+// TestFanOutHelperProcess is the child run of
+// TestFanOut_ChildDoesNotFanOutAgain. It fails if the child would fan out
+// again, like main does with JENKINS_SERVERS set and fanOutChildEnv unset.
+func TestFanOutHelperProcess(t *testing.T) {
+	if os.Getenv("BUTLER_TEST_FANOUT_HELPER") == "" {
+		t.Skip("only run as child of a fan-out")
+	}
+	if !IsFanOutChild() || os.Getenv("JENKINS_SERVERS") != "" {
+		os.Exit(3)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"strings"
 )
 
@@ -13,22 +14,99 @@ type JenkinsFolder struct {
 	Properties struct {
 		CredentialProperty struct {
 			DomainCredentials struct {
-				Class string `xml:"class,attr"`
-				Entry struct {
-					Credentials Credentials `xml:"java.util.concurrent.CopyOnWriteArrayList"`
-				} `xml:"entry"`
+				Class   string              `xml:"class,attr"`
+				Entries []DomainCredentials `xml:"entry"`
 			} `xml:"domainCredentialsMap"`
 		} `xml:"com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty"`
 	} `xml:"properties"`
 }
 
+type DomainCredentials struct {
+	Domain      Domain      `xml:"com.cloudbees.plugins.credentials.domains.Domain" json:"domain"`
+	Credentials Credentials `xml:"java.util.concurrent.CopyOnWriteArrayList" json:"credentials"`
+}
+
+// Domain is a credentials domain, the global domain has no name.
+type Domain struct {
+	Name           string               `xml:"name" json:"name"`
+	Description    string               `xml:"description" json:"description"`
+	Specifications DomainSpecifications `xml:"specifications" json:"specifications"`
+}
+
+type DomainSpecification struct {
+	Class         string `json:"class"`
+	Includes      string `json:"includes,omitempty"`
+	Excludes      string `json:"excludes,omitempty"`
+	Schemes       string `json:"schemes,omitempty"`
+	CaseSensitive bool   `json:"caseSensitive,omitempty"`
+}
+
+type DomainSpecifications []DomainSpecification
+
+// UnmarshalXML reads the specifications of a domain, which are serialized
+// as one element per specification class.
+func (specifications *DomainSpecifications) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Items []struct {
+			XMLName  xml.Name
+			Includes string `xml:"includes"`
+			Excludes string `xml:"excludes"`
+			Schemes  struct {
+				Text   string   `xml:",chardata"`
+				Values []string `xml:"string"`
+			} `xml:"schemes"`
+			CaseSensitive bool `xml:"caseSensitive"`
+		} `xml:",any"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*specifications = make(DomainSpecifications, 0, len(raw.Items))
+	for _, item := range raw.Items {
+		schemes := strings.TrimSpace(item.Schemes.Text)
+		if schemes == "" {
+			schemes = strings.Join(item.Schemes.Values, ",")
+		}
+		*specifications = append(*specifications, DomainSpecification{
+			Class:         item.XMLName.Local,
+			Includes:      item.Includes,
+			Excludes:      item.Excludes,
+			Schemes:       schemes,
+			CaseSensitive: item.CaseSensitive,
+		})
+	}
+	return nil
+}
+
 type Credentials struct {
 	UsernamePassword []UsernamePasswordCredential `xml:"com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl" json:"userpass"`
 	SecretFile       []SecretFileCredential       `xml:"org.jenkinsci.plugins.plaincredentials.impl.FileCredentialsImpl" json:"secretfile"`
+	SecretText       []SecretTextCredential       `xml:"org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl" json:"secrettext"`
+	SSHPrivateKey    []SSHPrivateKeyCredential    `xml:"com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey" json:"sshkey"`
+	Certificate      []CertificateCredential      `xml:"com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl" json:"certificate"`
+	GitHubApp        []GitHubAppCredential        `xml:"org.jenkinsci.plugins.github__branch__source.GitHubAppCredentials" json:"githubapp"`
+	Unsupported      []UnsupportedCredential      `xml:",any" json:"-"`
+}
+
+// UnsupportedCredential is a credential of a type butler cannot export. In
+// config.xml the type is the element name, the scripts report it as Type.
+type UnsupportedCredential struct {
+	XMLName xml.Name `json:"-"`
+	ID      string   `xml:"id" json:"id"`
+	Type    string   `xml:"-" json:"type"`
+}
+
+func (credential *UnsupportedCredential) GetType() string {
+	if credential.Type != "" {
+		return credential.Type
+	}
+	return credential.XMLName.Local
 }
 
 type UsernamePasswordCredential struct {
 	Plugin      string `xml:"plugin,attr" json:"plugin"`
+	Scope       string `xml:"scope" json:"scope"`
 	ID          string `xml:"id" json:"id"`
 	Description string `xml:"description" json:"description"`
 	Username    string `xml:"username" json:"username"`
@@ -37,25 +115,67 @@ type UsernamePasswordCredential struct {
 
 type SecretFileCredential struct {
 	Plugin             string `xml:"plugin,attr"`
+	Scope              string `xml:"scope" json:"scope"`
 	ID                 string `xml:"id" json:"id"`
 	Description        string `xml:"description" json:"description"`
 	FileName           string `xml:"fileName" json:"fileName"`
 	SecretBytes        string `xml:"secretBytes" json:"secretBytes"`
 	EncodedSecretBytes string `xml:"encodedSecretBytes" json:"encodedSecretBytes"`
+	RawString          string `xml:"-" json:"rawString,omitempty"`
 }
 
+type SecretTextCredential struct {
+	Plugin      string `xml:"plugin,attr" json:"plugin"`
+	Scope       string `xml:"scope" json:"scope"`
+	ID          string `xml:"id" json:"id"`
+	Description string `xml:"description" json:"description"`
+	Secret      string `xml:"secret" json:"secret"`
+}
+
+type SSHPrivateKeyCredential struct {
+	Plugin         string `xml:"plugin,attr" json:"plugin"`
+	Scope          string `xml:"scope" json:"scope"`
+	ID             string `xml:"id" json:"id"`
+	Description    string `xml:"description" json:"description"`
+	Username       string `xml:"username" json:"username"`
+	UsernameSecret bool   `xml:"usernameSecret" json:"usernameSecret"`
+	PrivateKey     string `xml:"privateKeySource>privateKey" json:"privateKey"`
+	Passphrase     string `xml:"passphrase" json:"passphrase"`
+}
+
+type CertificateCredential struct {
+	Plugin          string `xml:"plugin,attr" json:"plugin"`
+	Scope           string `xml:"scope" json:"scope"`
+	ID              string `xml:"id" json:"id"`
+	Description     string `xml:"description" json:"description"`
+	Password        string `xml:"password" json:"password"`
+	KeyStoreBytes   string `xml:"keyStoreSource>uploadedKeystoreBytes" json:"keyStoreBytes"`
+	EncodedKeyStore string `xml:"encodedKeyStore" json:"encodedKeyStore"`
+}
+
+type GitHubAppCredential struct {
+	Plugin      string `xml:"plugin,attr" json:"plugin"`
+	Scope       string `xml:"scope" json:"scope"`
+	ID          string `xml:"id" json:"id"`
+	Description string `xml:"description" json:"description"`
+	AppID       string `xml:"appID" json:"appID"`
+	PrivateKey  string `xml:"privateKey" json:"privateKey"`
+	APIURI      string `xml:"apiUri" json:"apiUri"`
+	Owner       string `xml:"owner" json:"owner"`
+}
+
+// GetFolderURL returns the URL of an item by its full name, like team/app.
+// The segments of the name are path escaped.
 func GetFolderURL(url string, folderName string) string {
 	if folderName == "" {
 		return url
 	}
 
 	url = strings.TrimRight(url, "/")
-	folderName = strings.TrimRight(folderName, "/")
-	if !strings.HasPrefix(folderName, "/") {
-		folderName = "/" + folderName
+	for _, segment := range strings.Split(strings.Trim(folderName, "/"), "/") {
+		url += "/job/" + neturl.PathEscape(segment)
 	}
-	path := strings.Replace(folderName, "/", "/job/", -1)
-	return url + path
+	return url
 }
 
 func parseJenkinsFolder(xmlInput []byte) JenkinsFolder {
@@ -65,8 +185,23 @@ func parseJenkinsFolder(xmlInput []byte) JenkinsFolder {
 	return folder
 }
 
+func (folder *JenkinsFolder) GetDomainCredentials() []DomainCredentials {
+	return folder.Properties.CredentialProperty.DomainCredentials.Entries
+}
+
+// GetCredentials returns the credentials of all domains.
 func (folder *JenkinsFolder) GetCredentials() Credentials {
-	return folder.Properties.CredentialProperty.DomainCredentials.Entry.Credentials
+	var credentials Credentials
+	for _, entry := range folder.GetDomainCredentials() {
+		credentials.UsernamePassword = append(credentials.UsernamePassword, entry.Credentials.UsernamePassword...)
+		credentials.SecretFile = append(credentials.SecretFile, entry.Credentials.SecretFile...)
+		credentials.SecretText = append(credentials.SecretText, entry.Credentials.SecretText...)
+		credentials.SSHPrivateKey = append(credentials.SSHPrivateKey, entry.Credentials.SSHPrivateKey...)
+		credentials.Certificate = append(credentials.Certificate, entry.Credentials.Certificate...)
+		credentials.GitHubApp = append(credentials.GitHubApp, entry.Credentials.GitHubApp...)
+		credentials.Unsupported = append(credentials.Unsupported, entry.Credentials.Unsupported...)
+	}
+	return credentials
 }
 
 func GetFolder(url string, folderName string, username string, password string) (JenkinsFolder, error) {
@@ -89,6 +224,10 @@ func GetFolder(url string, folderName string, username string, password string)
 		return JenkinsFolder{}, errors.New("Unauthorized 401")
 	}
 
+	if resp.StatusCode != 200 {
+		return JenkinsFolder{}, fmt.Errorf("Folder %s cannot be read: %s", folderName, resp.Status)
+	}
+
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return JenkinsFolder{}, err
@@ -56,6 +56,14 @@ func TestGetFolderURL(t *testing.T) {
 			},
 			want: "https://sample-jenkins/job/BLA/job/BLUB",
 		},
+		{
+			name: "With special characters",
+			args: args{
+				url:        "https://sample-jenkins",
+				folderName: "my team/app #1?",
+			},
+			want: "https://sample-jenkins/job/my%20team/job/app%20%231%3F",
+		},
 		{
 			name: "With empty folder name",
 			args: args{
@@ -131,3 +139,143 @@ func TestParseJenkinsFolder(t *testing.T) {
 	assert.NotNil(got, "Should not be nil.")
 	assert.Equal(got.GetCredentials().UsernamePassword[0].ID, "test")
 }
+
+func TestParseJenkinsFolder_CredentialTypes(t *testing.T) {
+	assert := assert.New(t)
+	xml := `<?xml version='1.1' encoding='UTF-8'?>
+<com.cloudbees.hudson.plugins.folder.Folder plugin="cloudbees-folder@6.15">
+  <properties>
+    <com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+      <domainCredentialsMap class="hudson.util.CopyOnWriteMap$Hash">
+        <entry>
+          <com.cloudbees.plugins.credentials.domains.Domain plugin="credentials@2.3.15">
+            <specifications/>
+          </com.cloudbees.plugins.credentials.domains.Domain>
+          <java.util.concurrent.CopyOnWriteArrayList>
+            <org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl plugin="plain-credentials@1.7">
+              <scope>GLOBAL</scope>
+              <id>token</id>
+              <description>API token</description>
+              <secret>{AQAAABAAAAAQ7EzV5N/fXZEKM9HyG+1T66P67iqU+tptVCNuvNX1TM0=}</secret>
+            </org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl>
+            <com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey plugin="ssh-credentials@1.18.1">
+              <scope>SYSTEM</scope>
+              <id>deploy-ssh</id>
+              <description></description>
+              <username>git</username>
+              <usernameSecret>true</usernameSecret>
+              <privateKeySource class="com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey$DirectEntryPrivateKeySource">
+                <privateKey>{AQAAABAAAAAwkey=}</privateKey>
+              </privateKeySource>
+              <passphrase>{AQAAABAAAAAQpass=}</passphrase>
+            </com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey>
+            <com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl plugin="credentials@2.3.15">
+              <scope>GLOBAL</scope>
+              <id>client-cert</id>
+              <description></description>
+              <keyStoreSource class="com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl$UploadedKeyStoreSource">
+                <uploadedKeystoreBytes>{keystore=}</uploadedKeystoreBytes>
+              </keyStoreSource>
+              <password>{AQAAABAAAAAQcert=}</password>
+            </com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl>
+            <org.jenkinsci.plugins.github__branch__source.GitHubAppCredentials plugin="github-branch-source@2.9.1">
+              <id>github-app</id>
+              <description></description>
+              <appID>12345</appID>
+              <privateKey>{AQAAABAAAAAQapp=}</privateKey>
+              <apiUri>https://github.example.com/api/v3</apiUri>
+              <owner>acme</owner>
+            </org.jenkinsci.plugins.github__branch__source.GitHubAppCredentials>
+            <com.cloudbees.jenkins.plugins.awscredentials.AWSCredentialsImpl plugin="aws-credentials@1.28">
+              <scope>GLOBAL</scope>
+              <id>aws</id>
+              <accessKey>AKIA</accessKey>
+              <secretKey>{AQAAABAAAAAQaws=}</secretKey>
+            </com.cloudbees.jenkins.plugins.awscredentials.AWSCredentialsImpl>
+          </java.util.concurrent.CopyOnWriteArrayList>
+        </entry>
+      </domainCredentialsMap>
+    </com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+  </properties>
+</com.cloudbees.hudson.plugins.folder.Folder>`
+
+	folder := parseJenkinsFolder([]byte(xml))
+	credentials := folder.GetCredentials()
+
+	assert.Equal("token", credentials.SecretText[0].ID)
+	assert.Equal("{AQAAABAAAAAQ7EzV5N/fXZEKM9HyG+1T66P67iqU+tptVCNuvNX1TM0=}", credentials.SecretText[0].Secret)
+	assert.Equal("SYSTEM", credentials.SSHPrivateKey[0].Scope)
+	assert.Equal("{AQAAABAAAAAwkey=}", credentials.SSHPrivateKey[0].PrivateKey)
+	assert.True(credentials.SSHPrivateKey[0].UsernameSecret)
+	assert.Equal("{keystore=}", credentials.Certificate[0].KeyStoreBytes)
+	assert.Equal("12345", credentials.GitHubApp[0].AppID)
+	assert.Equal("acme", credentials.GitHubApp[0].Owner)
+	assert.Len(credentials.Unsupported, 1)
+	assert.Equal("aws", credentials.Unsupported[0].ID)
+	assert.Equal("com.cloudbees.jenkins.plugins.awscredentials.AWSCredentialsImpl", credentials.Unsupported[0].GetType())
+}
+
+func TestParseJenkinsFolder_Domains(t *testing.T) {
+	assert := assert.New(t)
+	xml := `<?xml version='1.1' encoding='UTF-8'?>
+<com.cloudbees.hudson.plugins.folder.Folder plugin="cloudbees-folder@6.15">
+  <properties>
+    <com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+      <domainCredentialsMap class="hudson.util.CopyOnWriteMap$Hash">
+        <entry>
+          <com.cloudbees.plugins.credentials.domains.Domain plugin="credentials@2.3.15">
+            <specifications/>
+          </com.cloudbees.plugins.credentials.domains.Domain>
+          <java.util.concurrent.CopyOnWriteArrayList>
+            <com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl plugin="credentials@2.3.15">
+              <id>global-user</id>
+              <username>user</username>
+              <password>{AQAAABAAAAAQ}</password>
+            </com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl>
+          </java.util.concurrent.CopyOnWriteArrayList>
+        </entry>
+        <entry>
+          <com.cloudbees.plugins.credentials.domains.Domain plugin="credentials@2.3.15">
+            <name>artifactory</name>
+            <description>Artifactory hosts</description>
+            <specifications>
+              <com.cloudbees.plugins.credentials.domains.HostnameSpecification>
+                <includes>*.artifactory.example.com</includes>
+                <excludes></excludes>
+              </com.cloudbees.plugins.credentials.domains.HostnameSpecification>
+              <com.cloudbees.plugins.credentials.domains.SchemeSpecification>
+                <schemes class="java.util.TreeSet">
+                  <string>https</string>
+                </schemes>
+              </com.cloudbees.plugins.credentials.domains.SchemeSpecification>
+            </specifications>
+          </com.cloudbees.plugins.credentials.domains.Domain>
+          <java.util.concurrent.CopyOnWriteArrayList>
+            <org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl plugin="plain-credentials@1.7">
+              <id>artifactory-token</id>
+              <secret>{AQAAABAAAAAQ}</secret>
+            </org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl>
+          </java.util.concurrent.CopyOnWriteArrayList>
+        </entry>
+      </domainCredentialsMap>
+    </com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider_-FolderCredentialsProperty>
+  </properties>
+</com.cloudbees.hudson.plugins.folder.Folder>`
+
+	folder := parseJenkinsFolder([]byte(xml))
+	domains := folder.GetDomainCredentials()
+
+	assert.Len(domains, 2)
+	assert.Equal("", domains[0].Domain.Name)
+	assert.Empty(domains[0].Domain.Specifications)
+	assert.Equal("global-user", domains[0].Credentials.UsernamePassword[0].ID)
+	assert.Equal("artifactory", domains[1].Domain.Name)
+	assert.Equal("Artifactory hosts", domains[1].Domain.Description)
+	assert.Equal(DomainSpecifications{
+		{Class: "com.cloudbees.plugins.credentials.domains.HostnameSpecification", Includes: "*.artifactory.example.com"},
+		{Class: "com.cloudbees.plugins.credentials.domains.SchemeSpecification", Schemes: "https"},
+	}, domains[1].Domain.Specifications)
+	assert.Equal("artifactory-token", domains[1].Credentials.SecretText[0].ID)
+	assert.Len(folder.GetCredentials().UsernamePassword, 1)
+	assert.Len(folder.GetCredentials().SecretText, 1)
+}
@@ -1,43 +1,90 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 )
 
-func GetDecryptScriptForCredentials(credentials Credentials) string {
-	marshalledCredentials, _ := json.Marshal(credentials)
-	return strings.Replace(decryptScriptTemplate, "<<JSON HERE>>", string(marshalledCredentials), 1)
+// groovyString returns a Groovy expression evaluating to value. The value is
+// base64 encoded, so quotes, dollar signs or backslashes in it can neither
+// break the script nor inject code.
+func groovyString(value string) string {
+	return fmt.Sprintf("new String(java.util.Base64.decoder.decode('%s'), 'UTF-8')", base64.StdEncoding.EncodeToString([]byte(value)))
+}
+
+// renderGroovyScript replaces each placeholder of template with a safe
+// Groovy expression evaluating to its value.
+func renderGroovyScript(template string, values map[string]string) string {
+	for placeholder, value := range values {
+		template = strings.Replace(template, placeholder, groovyString(value), -1)
+	}
+	return template
+}
+
+func GetDecryptScriptForCredentials(bundle CredentialsBundle) string {
+	marshalledCredentials, _ := json.Marshal(bundle)
+	return renderGroovyScript(decryptScriptTemplate, map[string]string{
+		"<<JSON HERE>>": string(marshalledCredentials),
+	})
 }
 
 const decryptScriptTemplate = `import groovy.json.JsonSlurperClassic
 import groovy.json.JsonOutput
 import java.util.Base64
 
-def json = """<<JSON HERE>>"""
+def decrypt(credentials) {
+  credentials.userpass.each {
+    it.password = hudson.util.Secret.fromString(it.password).getPlainText()
+  }
 
-def data = new JsonSlurperClassic().parseText(json)
-data.userpass.each {
-  it.password = hudson.util.Secret.fromString(it.password).getPlainText()
+  credentials.secretfile.each {
+    it.rawString = new String(com.cloudbees.plugins.credentials.SecretBytes.fromString(it.secretBytes).getPlainData(), "ASCII")
+    it.encodedSecretBytes = new String(Base64.encoder.encode(com.cloudbees.plugins.credentials.SecretBytes.fromString(it.secretBytes).getPlainData()))
+  }
+
+  credentials.secrettext.each {
+    it.secret = hudson.util.Secret.fromString(it.secret).getPlainText()
+  }
+
+  credentials.sshkey.each {
+    it.privateKey = hudson.util.Secret.fromString(it.privateKey).getPlainText()
+    if (it.passphrase)
+      it.passphrase = hudson.util.Secret.fromString(it.passphrase).getPlainText()
+  }
+
+  credentials.certificate.each {
+    it.password = hudson.util.Secret.fromString(it.password).getPlainText()
+    it.encodedKeyStore = new String(Base64.encoder.encode(com.cloudbees.plugins.credentials.SecretBytes.fromString(it.keyStoreBytes).getPlainData()))
+  }
+
+  credentials.githubapp.each {
+    it.privateKey = hudson.util.Secret.fromString(it.privateKey).getPlainText()
+  }
 }
 
-data.secretfile.each {
-	it.rawString = new String(com.cloudbees.plugins.credentials.SecretBytes.fromString(it.secretBytes).getPlainData(), "ASCII")
-	it.encodedSecretBytes = new String(Base64.encoder.encode(com.cloudbees.plugins.credentials.SecretBytes.fromString(it.secretBytes).getPlainData()))
+def json = <<JSON HERE>>
+
+def data = new JsonSlurperClassic().parseText(json)
+data.domains.each {
+  decrypt(it.credentials)
 }
 
-println JsonOutput.toJson(data)`
+println "BUTLER_RESULT:" + JsonOutput.toJson(data)`
 
-func GetApplyScriptForCredentials(credentials Credentials, folderPath string) string {
-	marshalledCredentials, _ := json.Marshal(credentials)
-	templated := strings.Replace(createOrUpdateCredentialsTemplate, "<<JSON HERE>>", string(marshalledCredentials), 1)
-	templated = strings.Replace(templated, "<<FOLDER HERE>>", folderPath, 1)
-	return templated
+func GetApplyScriptForCredentials(bundle CredentialsBundle, folderPath string) string {
+	marshalledCredentials, _ := json.Marshal(bundle)
+	return renderGroovyScript(createOrUpdateCredentialsTemplate, map[string]string{
+		"<<JSON HERE>>":   string(marshalledCredentials),
+		"<<FOLDER HERE>>": folderPath,
+	})
 }
 
 const createOrUpdateCredentialsTemplate = `import com.cloudbees.hudson.plugins.folder.properties.FolderCredentialsProvider.FolderCredentialsProperty
@@ -51,69 +98,211 @@ import com.cloudbees.plugins.credentials.impl.*
 import org.jenkinsci.plugins.plaincredentials.*
 import org.jenkinsci.plugins.plaincredentials.impl.*
 import org.apache.commons.fileupload.FileItem
+import hudson.util.Secret
 import groovy.json.JsonSlurperClassic
 import groovy.json.JsonOutput
 import java.util.Base64
 
 
-def createOrUpdateCredential(credentialStore, newCredential, existingCredentials) {
+// Credential types of optional plugins are loaded lazily, so the script also
+// compiles on controllers without those plugins.
+def loadClass(String name) {
+    return Jenkins.instance.pluginManager.uberClassLoader.loadClass(name)
+}
+
+def scopeOf(rawCredential) {
+    return rawCredential.scope ? CredentialsScope.valueOf(rawCredential.scope) : CredentialsScope.GLOBAL
+}
+
+def specificationFrom(rawSpecification) {
+    switch (rawSpecification['class']) {
+        case HostnameSpecification.class.name:
+            return new HostnameSpecification(rawSpecification.includes, rawSpecification.excludes)
+        case HostnamePortSpecification.class.name:
+            return new HostnamePortSpecification(rawSpecification.includes, rawSpecification.excludes)
+        case SchemeSpecification.class.name:
+            return new SchemeSpecification(rawSpecification.schemes)
+        case PathSpecification.class.name:
+            return new PathSpecification(rawSpecification.includes, rawSpecification.excludes, rawSpecification.caseSensitive as boolean)
+    }
+    println "Skipping unsupported domain specification ${rawSpecification['class']}"
+    return null
+}
+
+def domainOf(credentialStore, rawDomain) {
+    if (!rawDomain?.name)
+        return Domain.global()
+
+    def specifications = (rawDomain.specifications ?: []).collect{ specificationFrom(it) }.findAll{ it != null }
+    def domain = new Domain(rawDomain.name, rawDomain.description, specifications)
+    def existingDomain = credentialStore.getDomainByName(rawDomain.name)
+    if (existingDomain)
+        credentialStore.updateDomain(existingDomain, domain)
+    else
+        credentialStore.addDomain(domain)
+    return credentialStore.getDomainByName(rawDomain.name)
+}
+
+def createOrUpdateCredential(credentialStore, domain, newCredential, existingCredentials) {
     def existingCredential = existingCredentials.find{c -> c.getId() == newCredential.getId()}
     if (existingCredential)
-        credentialStore.updateCredentials(Domain.global(), existingCredential, newCredential)
+        credentialStore.updateCredentials(domain, existingCredential, newCredential)
     else
-        credentialStore.addCredentials(Domain.global(), newCredential)
+        credentialStore.addCredentials(domain, newCredential)
 }
 
-def json = """<<JSON HERE>>"""
-String folderPath = "<<FOLDER HERE>>"
+def json = <<JSON HERE>>
+String folderPath = <<FOLDER HERE>>
 def data = new JsonSlurperClassic().parseText(json)
 
-Jenkins.instance.getAllItems(Folder.class)
-    .findAll{it.fullName.equals(folderPath)}
-    .each{
-        AbstractFolder<?> folderAbs = AbstractFolder.class.cast(it)
-      	println "We're at ${folderAbs.fullName}"
-        FolderCredentialsProperty property = folderAbs.getProperties().get(FolderCredentialsProperty.class)
-        if(property == null){
-            property = new FolderCredentialsProperty()
-            folderAbs.addProperty(property)
+// An empty folder path selects the global (system) credentials store.
+def stores = []
+if (folderPath.isEmpty()) {
+    stores << SystemCredentialsProvider.getInstance().getStore()
+} else {
+    Jenkins.instance.getAllItems(Folder.class)
+        .findAll{it.fullName.equals(folderPath)}
+        .each{
+            AbstractFolder<?> folderAbs = AbstractFolder.class.cast(it)
+            FolderCredentialsProperty property = folderAbs.getProperties().get(FolderCredentialsProperty.class)
+            if(property == null){
+                property = new FolderCredentialsProperty()
+                folderAbs.addProperty(property)
+            }
+            stores << property.getStore()
         }
+    if (stores.isEmpty())
+        throw new IllegalArgumentException("Folder ${folderPath} not found")
+}
 
-        def store = property.getStore()
-        def existingCredentials = property.getCredentials()
-        data.userpass.each {
-            Credentials c = new UsernamePasswordCredentialsImpl(CredentialsScope.GLOBAL, it.id, it.description, it.username, it.password)
-            createOrUpdateCredential(store, c, existingCredentials)
-		}
-		data.secretfile.each {
-			def rawSecretFile = it
-			fileItem = [ getName: { return rawSecretFile.fileName},  get: { return Base64.decoder.decode(rawSecretFile.encodedSecretBytes) } ] as FileItem
-			secretFile = new FileCredentialsImpl(
-				CredentialsScope.GLOBAL,
-				rawSecretFile.id,
-				rawSecretFile.description,
-				fileItem, // Don't use FileItem
-				null,
-				"")
-			createOrUpdateCredential(store, secretFile, existingCredentials)
-		}
-        println existingCredentials.toString()
-}`
+def applied = []
 
-func ExecuteGroovyScriptOnJenkins(script string, rawUrl string, username string, password string) string {
+stores.each { store ->
+    data.domains.each { entry ->
+        def domain = domainOf(store, entry.domain)
+        def credentials = entry.credentials
+        def existingCredentials = store.getCredentials(domain)
+        credentials.userpass.each {
+            Credentials c = new UsernamePasswordCredentialsImpl(scopeOf(it), it.id, it.description, it.username, it.password)
+            createOrUpdateCredential(store, domain, c, existingCredentials)
+        }
+        credentials.secretfile.each {
+            def rawSecretFile = it
+            def fileItem = [ getName: { return rawSecretFile.fileName},  get: { return Base64.decoder.decode(rawSecretFile.encodedSecretBytes) } ] as FileItem
+            def secretFile = new FileCredentialsImpl(
+                scopeOf(rawSecretFile),
+                rawSecretFile.id,
+                rawSecretFile.description,
+                fileItem, // Don't use FileItem
+                null,
+                "")
+            createOrUpdateCredential(store, domain, secretFile, existingCredentials)
+        }
+        credentials.secrettext.each {
+            Credentials c = new StringCredentialsImpl(scopeOf(it), it.id, it.description, Secret.fromString(it.secret))
+            createOrUpdateCredential(store, domain, c, existingCredentials)
+        }
+        credentials.sshkey.each {
+            def keySource = loadClass('com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey$DirectEntryPrivateKeySource').newInstance(it.privateKey)
+            def c = loadClass('com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey').newInstance(scopeOf(it), it.id, it.username, keySource, it.passphrase ?: null, it.description)
+            if (it.usernameSecret)
+                c.usernameSecret = true
+            createOrUpdateCredential(store, domain, c, existingCredentials)
+        }
+        credentials.certificate.each {
+            def keyStore = SecretBytes.fromBytes(Base64.decoder.decode(it.encodedKeyStore))
+            Credentials c = new CertificateCredentialsImpl(scopeOf(it), it.id, it.description, it.password, new CertificateCredentialsImpl.UploadedKeyStoreSource(keyStore))
+            createOrUpdateCredential(store, domain, c, existingCredentials)
+        }
+        credentials.githubapp.each {
+            def c = loadClass('org.jenkinsci.plugins.github_branch_source.GitHubAppCredentials').newInstance(scopeOf(it), it.id, it.description, it.appID, Secret.fromString(it.privateKey))
+            if (it.apiUri)
+                c.apiUri = it.apiUri
+            if (it.owner)
+                c.owner = it.owner
+            createOrUpdateCredential(store, domain, c, existingCredentials)
+        }
+        def ids = ['userpass', 'secretfile', 'secrettext', 'sshkey', 'certificate', 'githubapp'].collectMany{ credentials[it] ?: [] }.collect{ it.id }
+        applied << [domain: domain.name ?: "", ids: ids]
+    }
+}
+
+println "BUTLER_RESULT:" + JsonOutput.toJson(applied)`
+
+func GetDecryptScriptForSystemCredentials() string {
+	return decryptSystemCredentialsScript
+}
+
+const decryptSystemCredentialsScript = `import com.cloudbees.plugins.credentials.SystemCredentialsProvider
+import groovy.json.JsonOutput
+import java.util.Base64
+
+def specificationOf(specification) {
+    def raw = ['class': specification.getClass().name]
+    ['includes', 'excludes', 'schemes', 'caseSensitive'].each { property ->
+        if (specification.hasProperty(property))
+            raw[property] = specification[property]
+    }
+    return raw
+}
+
+def addCredential(data, unsupported, c) {
+    def raw = [scope: c.scope?.name(), id: c.id, description: c.description]
+    switch (c.getClass().name) {
+        case 'com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl':
+            data.userpass << raw + [username: c.username, password: c.password.plainText]
+            break
+        case 'org.jenkinsci.plugins.plaincredentials.impl.FileCredentialsImpl':
+            def bytes = c.content.bytes
+            data.secretfile << raw + [fileName: c.fileName, rawString: new String(bytes, "ASCII"), encodedSecretBytes: new String(Base64.encoder.encode(bytes))]
+            break
+        case 'org.jenkinsci.plugins.plaincredentials.impl.StringCredentialsImpl':
+            data.secrettext << raw + [secret: c.secret.plainText]
+            break
+        case 'com.cloudbees.jenkins.plugins.sshcredentials.impl.BasicSSHUserPrivateKey':
+            data.sshkey << raw + [username: c.username, usernameSecret: c.hasProperty('usernameSecret') ? c.usernameSecret : false, privateKey: c.privateKeys.join("\n"), passphrase: c.passphrase?.plainText]
+            break
+        case 'com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl':
+            data.certificate << raw + [password: c.password.plainText, encodedKeyStore: new String(Base64.encoder.encode(c.keyStoreSource.keyStoreBytes))]
+            break
+        case 'org.jenkinsci.plugins.github_branch_source.GitHubAppCredentials':
+            data.githubapp << raw + [appID: c.appID, privateKey: c.privateKey.plainText, apiUri: c.apiUri, owner: c.owner]
+            break
+        default:
+            unsupported << [id: c.id, type: c.getClass().name]
+    }
+}
+
+def store = SystemCredentialsProvider.getInstance().getStore()
+def unsupported = []
+def domains = store.getDomains().collect { domain ->
+    def credentials = [userpass: [], secretfile: [], secrettext: [], sshkey: [], certificate: [], githubapp: []]
+    store.getCredentials(domain).each { addCredential(credentials, unsupported, it) }
+    [
+        domain: [name: domain.name, description: domain.description, specifications: domain.specifications.collect { specificationOf(it) }],
+        credentials: credentials
+    ]
+}
+
+println "BUTLER_RESULT:" + JsonOutput.toJson([domains: domains, unsupported: unsupported])`
+
+// ExecuteGroovyScriptOnJenkins runs script in the script console and returns
+// its output. Failed requests and scripts which end in an exception are
+// reported as error.
+func ExecuteGroovyScriptOnJenkins(script string, rawUrl string, username string, password string) (string, error) {
 	apiURL := fmt.Sprintf("%s/scriptText", rawUrl)
 	data := url.Values{}
 	data.Set("script", script)
 	body := strings.NewReader(data.Encode())
 	req, err := http.NewRequest("POST", apiURL, body)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	crumb, err := GetCrumb(rawUrl, username, password)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "No crumb issueing possible: %v", err)
+		fmt.Fprintf(os.Stderr, "No crumb issueing possible: %v\n", err)
 	} else {
 		req.Header.Set(crumb[0], crumb[1])
 	}
@@ -121,9 +310,129 @@ func ExecuteGroovyScriptOnJenkins(script string, rawUrl string, username string,
 	req.SetBasicAuth(username, password)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer resp.Body.Close()
-	responseBody, _ := ioutil.ReadAll(resp.Body)
-	return string(responseBody)
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == 401 {
+		return "", errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Script cannot be executed: %s", resp.Status)
+	}
+
+	output := string(responseBody)
+	return output, detectGroovyException(output)
+}
+
+// groovyResultMarker prefixes the line a script prints its JSON result on,
+// so the result can be told apart from any other output of the script.
+const groovyResultMarker = "BUTLER_RESULT:"
+
+// ExecuteGroovyScriptForResult runs script and decodes the JSON result it
+// printed after groovyResultMarker into result.
+func ExecuteGroovyScriptForResult(script string, rawUrl string, username string, password string, result interface{}) error {
+	output, err := ExecuteGroovyScriptOnJenkins(script, rawUrl, username, password)
+	if err != nil {
+		return err
+	}
+	return parseGroovyResult(output, result)
+}
+
+func parseGroovyResult(output string, result interface{}) error {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], groovyResultMarker) {
+			return json.Unmarshal([]byte(strings.TrimPrefix(lines[i], groovyResultMarker)), result)
+		}
+	}
+	return fmt.Errorf("Script returned no result: %s", strings.TrimSpace(output))
 }
+
+var (
+	groovyExceptionPattern  = regexp.MustCompile(`^([\w$]+\.)+[\w$]*(Exception|Error)(: .*)?$`)
+	groovyStackFramePattern = regexp.MustCompile(`^\s+at \S+\(.*\)$`)
+)
+
+// detectGroovyException finds the stack trace the script console prints,
+// with a status of 200, when a script fails.
+func detectGroovyException(output string) error {
+	lines := strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		if !groovyStackFramePattern.MatchString(line) {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if groovyExceptionPattern.MatchString(lines[j]) {
+				return fmt.Errorf("Script failed: %s", lines[j])
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+const pluginWarningsScript = `import groovy.json.JsonOutput
+import hudson.util.VersionNumber
+import jenkins.model.Jenkins
+import jenkins.security.UpdateSiteWarningsMonitor
+
+def jenkins = Jenkins.instance
+def monitor = jenkins.getExtensionList(UpdateSiteWarningsMonitor.class).get(0)
+def result = []
+
+monitor.getActivePluginWarningsByPlugin().each { plugin, warnings ->
+    def available = jenkins.updateCenter.getPlugin(plugin.shortName)
+    warnings.each { warning ->
+        def fixed = ""
+        if (available != null && !warning.isRelevantToVersion(new VersionNumber(available.version))) {
+            fixed = available.version
+        }
+        def affected = warning.versionRanges.collect { range ->
+            if (range.firstVersion && range.lastVersion)
+                return "${range.firstVersion} - ${range.lastVersion}".toString()
+            if (range.lastVersion)
+                return "<= ${range.lastVersion}".toString()
+            return range.pattern.toString()
+        }
+        result << [
+            plugin: plugin.shortName,
+            groupId: plugin.manifest.mainAttributes.getValue("Group-Id") ?: "",
+            version: plugin.version,
+            id: warning.id,
+            message: warning.message,
+            url: warning.url,
+            affected: affected,
+            fixed: fixed
+        ]
+    }
+}
+
+println "BUTLER_RESULT:" + JsonOutput.toJson(result)`
+
+const listSystemCredentialsScript = `import com.cloudbees.plugins.credentials.SystemCredentialsProvider
+import groovy.json.JsonOutput
+
+def store = SystemCredentialsProvider.getInstance().getStore()
+def result = []
+
+store.getDomains().each { domain ->
+    store.getCredentials(domain).each { c ->
+        result << [
+            folder: "",
+            domain: domain.name ?: "",
+            id: c.id,
+            type: c.descriptor.displayName,
+            scope: c.scope?.name() ?: "",
+            description: c.description ?: ""
+        ]
+    }
+}
+
+println "BUTLER_RESULT:" + JsonOutput.toJson(result)`
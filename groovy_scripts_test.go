@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hostileValues = []string{
+	`"""; Jenkins.instance.doSafeExit(null); """`,
+	`${Jenkins.instance.doSafeExit(null)}`,
+	`$ENV`,
+	`back\slash\`,
+	`quote'"`,
+	"new\nline",
+	"<<FOLDER HERE>>",
+}
+
+var groovyStringPattern = regexp.MustCompile(`new String\(java\.util\.Base64\.decoder\.decode\('([A-Za-z0-9+/=]*)'\), 'UTF-8'\)`)
+
+// decodedGroovyStrings returns the values of all groovyString expressions in script.
+func decodedGroovyStrings(t *testing.T, script string) []string {
+	var values []string
+	for _, match := range groovyStringPattern.FindAllStringSubmatch(script, -1) {
+		value, err := base64.StdEncoding.DecodeString(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, string(value))
+	}
+	return values
+}
+
+func TestGetApplyScriptForCredentials_HostileInput(t *testing.T) {
+	assert := assert.New(t)
+	for _, hostile := range hostileValues {
+		bundle := CredentialsBundle{Domains: []DomainCredentials{{Credentials: Credentials{
+			UsernamePassword: []UsernamePasswordCredential{{ID: "test", Username: hostile, Password: hostile}},
+		}}}}
+
+		script := GetApplyScriptForCredentials(bundle, hostile)
+
+		withoutPayload := groovyStringPattern.ReplaceAllString(script, "")
+		assert.NotContains(withoutPayload, hostile)
+		assert.NotContains(withoutPayload, "<<JSON HERE>>")
+		assert.NotContains(withoutPayload, "<<FOLDER HERE>>")
+
+		values := decodedGroovyStrings(t, script)
+		assert.Len(values, 2)
+		parsed, err := ParseCredentialsBundle([]byte(values[0]))
+		assert.Nil(err)
+		assert.Equal(hostile, parsed.Domains[0].Credentials.UsernamePassword[0].Password)
+		assert.Equal(hostile, values[1])
+	}
+}
+
+func TestGetDecryptScriptForCredentials_HostileInput(t *testing.T) {
+	assert := assert.New(t)
+	for _, hostile := range hostileValues {
+		bundle := CredentialsBundle{Domains: []DomainCredentials{{Credentials: Credentials{
+			SecretText: []SecretTextCredential{{ID: hostile, Description: hostile, Secret: "{AQAAABAAAAAQ}"}},
+		}}}}
+
+		script := GetDecryptScriptForCredentials(bundle)
+
+		assert.NotContains(groovyStringPattern.ReplaceAllString(script, ""), hostile)
+		values := decodedGroovyStrings(t, script)
+		assert.Len(values, 1)
+		parsed, err := ParseCredentialsBundle([]byte(values[0]))
+		assert.Nil(err)
+		assert.Equal(hostile, parsed.Domains[0].Credentials.SecretText[0].ID)
+	}
+}
+
+func Test_groovyString(t *testing.T) {
+	got := groovyString("it's $5 \\ \"\"\"")
+
+	assert.False(t, strings.ContainsAny(got, `"$\`))
+	assert.Equal(t, []string{"it's $5 \\ \"\"\""}, decodedGroovyStrings(t, got))
+}
+
+func Test_detectGroovyException(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantErr bool
+	}{
+		{"Plain output", "Hello\nWorld\n", false},
+		{"Output mentioning an exception", "java.lang.IllegalStateException: handled\n", false},
+		{
+			"Runtime exception",
+			"partial output\ngroovy.lang.MissingPropertyException: No such property: foo for class: Script1\n\tat org.codehaus.groovy.runtime.ScriptBytecodeAdapter.unwrap(ScriptBytecodeAdapter.java:66)\n\tat Script1.run(Script1.groovy:1)\n",
+			true,
+		},
+		{
+			"Compilation error",
+			"org.codehaus.groovy.control.MultipleCompilationErrorsException: startup failed:\nScript1.groovy: 1: unexpected token: } @ line 1, column 1.\n   }\n   ^\n\n1 error\n\n\tat org.codehaus.groovy.control.ErrorCollector.failIfErrors(ErrorCollector.java:310)\n",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := detectGroovyException(tt.output); (err != nil) != tt.wantErr {
+				t.Errorf("detectGroovyException() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parseGroovyResult(t *testing.T) {
+	assert := assert.New(t)
+	var result []string
+
+	err := parseGroovyResult("some log line\nBUTLER_RESULT:[\"a\",\"b\"]\n", &result)
+	assert.Nil(err)
+	assert.Equal([]string{"a", "b"}, result)
+
+	err = parseGroovyResult("no result here\n", &result)
+	assert.NotNil(err)
+}
+
+func TestExecuteGroovyScriptOnJenkins(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{"Success", 200, "BUTLER_RESULT:{}\n", "BUTLER_RESULT:{}\n", false},
+		{"Forbidden", 403, "Forbidden", "", true},
+		{"Exception", 200, "java.lang.NullPointerException\n\tat Script1.run(Script1.groovy:3)\n", "java.lang.NullPointerException\n\tat Script1.run(Script1.groovy:3)\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/scriptText" {
+					w.WriteHeader(404)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.output))
+			}))
+			defer server.Close()
+
+			got, err := ExecuteGroovyScriptOnJenkins("println 'hello'", server.URL, "user", "password")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecuteGroovyScriptOnJenkins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExecuteGroovyScriptOnJenkins() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
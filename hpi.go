@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type PluginDependency struct {
+	Name     string `json:"shortName"`
+	Version  string `json:"version"`
+	Optional bool   `json:"optional"`
+}
+
+type PluginFile struct {
+	Path         string
+	Name         string
+	Version      string
+	Dependencies []PluginDependency
+}
+
+// parseManifest reads a jar manifest, joining continuation lines (lines
+// starting with a single space) onto the preceding header.
+func parseManifest(content string) map[string]string {
+	headers := make(map[string]string)
+	var lastKey string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && lastKey != "" {
+			headers[lastKey] += line[1:]
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		lastKey = strings.TrimSpace(parts[0])
+		headers[lastKey] = strings.TrimSpace(parts[1])
+	}
+	return headers
+}
+
+func parsePluginDependencies(header string) []PluginDependency {
+	dependencies := make([]PluginDependency, 0)
+	for _, entry := range strings.Split(header, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		optional := strings.Contains(entry, ";resolution:=optional")
+		entry = strings.Split(entry, ";")[0]
+		parts := strings.SplitN(entry, ":", 2)
+		dependency := PluginDependency{Name: parts[0], Optional: optional}
+		if len(parts) == 2 {
+			dependency.Version = parts[1]
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+func ReadPluginFile(path string) (PluginFile, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return PluginFile{}, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != "META-INF/MANIFEST.MF" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return PluginFile{}, err
+		}
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return PluginFile{}, err
+		}
+
+		headers := parseManifest(string(data))
+		if headers["Short-Name"] == "" {
+			return PluginFile{}, fmt.Errorf("%s is not a Jenkins plugin: Short-Name missing in manifest", path)
+		}
+		return PluginFile{
+			Path:         path,
+			Name:         headers["Short-Name"],
+			Version:      headers["Plugin-Version"],
+			Dependencies: parsePluginDependencies(headers["Plugin-Dependencies"]),
+		}, nil
+	}
+	return PluginFile{}, fmt.Errorf("%s has no manifest", path)
+}
+
+// sortPluginFilesByDependencies orders plugins so that every plugin comes
+// after the plugins it depends on. Dependencies which are not part of the
+// given files are expected to be installed already.
+func sortPluginFilesByDependencies(files []PluginFile) ([]PluginFile, error) {
+	byName := make(map[string]PluginFile)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		byName[file.Name] = file
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+
+	sorted := make([]PluginFile, 0, len(files))
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("Cyclic plugin dependency: %s -> %s", strings.Join(path, " -> "), name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dependency := range byName[name].Dependencies {
+			if _, ok := byName[dependency.Name]; !ok {
+				continue
+			}
+			if err := visit(dependency.Name, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		sorted = append(sorted, byName[name])
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, []string{}); err != nil {
+			return []PluginFile{}, err
+		}
+	}
+	return sorted, nil
+}
+
+func ImportPluginFiles(server string, username string, password string, directory string) error {
+	var paths []string
+	for _, pattern := range []string{"*.hpi", "*.jpi"} {
+		matches, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+
+	if len(paths) == 0 {
+		return fmt.Errorf("No .hpi or .jpi files found in %s", directory)
+	}
+
+	files := make([]PluginFile, 0, len(paths))
+	pathsByName := make(map[string]string)
+	for _, path := range paths {
+		file, err := ReadPluginFile(path)
+		if err != nil {
+			return err
+		}
+		if other, ok := pathsByName[file.Name]; ok {
+			return fmt.Errorf("Plugin %s is found in both %s and %s", file.Name, other, path)
+		}
+		pathsByName[file.Name] = path
+		files = append(files, file)
+	}
+
+	files, err := sortPluginFilesByDependencies(files)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fmt.Printf("Uploading %s@%s\n", file.Name, file.Version)
+		err := UploadPluginFile(server, username, password, file.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UploadPluginFile(server string, username string, password string, path string) error {
+	url := fmt.Sprintf("%s/pluginManager/uploadPlugin", server)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("name", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	writer.Close()
+
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Plugin %s cannot be uploaded: %s", filepath.Base(path), resp.Status)
+	}
+	return nil
+}
+
+func DownloadPlugins(mirror string, directory string) error {
+	file, err := os.Open("plugins.txt")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := os.Mkdir(directory, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "@", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("No version given for plugin %s", line)
+		}
+
+		fmt.Printf("Downloading %s\n", line)
+		err := DownloadPlugin(mirror, parts[0], parts[1], directory)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func DownloadPlugin(mirror string, name string, version string, directory string) error {
+	url := fmt.Sprintf("%s/plugins/%s/%s/%s.hpi", strings.TrimRight(mirror, "/"), name, version, name)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Plugin %s@%s cannot be downloaded from %s: %s", name, version, url, resp.Status)
+	}
+
+	// Download next to the target so a failed transfer leaves no truncated .hpi
+	f, err := ioutil.TempFile(directory, name+".hpi.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, resp.Body)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(directory, name+".hpi"))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseManifest(t *testing.T) {
+	assert := assert.New(t)
+	manifest := "Manifest-Version: 1.0\r\n" +
+		"Short-Name: workflow-job\r\n" +
+		"Plugin-Version: 2.40\r\n" +
+		"Plugin-Dependencies: workflow-api:2.40,workflow-step-api:2.22,workflo\r\n" +
+		" w-support:3.5;resolution:=optional\r\n"
+
+	got := parseManifest(manifest)
+
+	assert.Equal("workflow-job", got["Short-Name"])
+	assert.Equal("2.40", got["Plugin-Version"])
+	assert.Equal("workflow-api:2.40,workflow-step-api:2.22,workflow-support:3.5;resolution:=optional", got["Plugin-Dependencies"])
+}
+
+func Test_parsePluginDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []PluginDependency
+	}{
+		{"Empty", "", []PluginDependency{}},
+		{
+			"Mandatory and optional",
+			"workflow-api:2.40,workflow-support:3.5;resolution:=optional",
+			[]PluginDependency{
+				{Name: "workflow-api", Version: "2.40"},
+				{Name: "workflow-support", Version: "3.5", Optional: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePluginDependencies(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePluginDependencies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sortPluginFilesByDependencies(t *testing.T) {
+	assert := assert.New(t)
+	files := []PluginFile{
+		{Name: "workflow-job", Dependencies: []PluginDependency{{Name: "workflow-api"}, {Name: "structs"}}},
+		{Name: "workflow-api", Dependencies: []PluginDependency{{Name: "scm-api"}}},
+		{Name: "scm-api", Dependencies: []PluginDependency{{Name: "installed-elsewhere"}}},
+	}
+
+	sorted, err := sortPluginFilesByDependencies(files)
+
+	assert.Nil(err)
+	var names []string
+	for _, file := range sorted {
+		names = append(names, file.Name)
+	}
+	assert.Equal([]string{"scm-api", "workflow-api", "workflow-job"}, names)
+}
+
+func Test_sortPluginFilesByDependencies_Cycle(t *testing.T) {
+	files := []PluginFile{
+		{Name: "a", Dependencies: []PluginDependency{{Name: "b"}}},
+		{Name: "b", Dependencies: []PluginDependency{{Name: "a"}}},
+	}
+
+	_, err := sortPluginFilesByDependencies(files)
+
+	assert.NotNil(t, err)
+}
+
+func writePluginFile(t *testing.T, path string, name string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	archive := zip.NewWriter(f)
+	manifest, err := archive.Create("META-INF/MANIFEST.MF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Write([]byte("Short-Name: " + name + "\nPlugin-Version: 1.0\n"))
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportPluginFiles_HpiAndJpi(t *testing.T) {
+	directory, err := ioutil.TempDir("", "butler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	writePluginFile(t, filepath.Join(directory, "git.hpi"), "git")
+	writePluginFile(t, filepath.Join(directory, "git.jpi"), "git")
+
+	err = ImportPluginFiles("http://localhost:0", "user", "password", directory)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Plugin git is found in both")
+}
+
+func TestDownloadPlugin_Truncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+	}))
+	defer server.Close()
+	directory, err := ioutil.TempDir("", "butler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	err = DownloadPlugin(server.URL, "git", "5.2.0", directory)
+
+	assert.NotNil(t, err)
+	files, _ := ioutil.ReadDir(directory)
+	assert.Empty(t, files)
+}
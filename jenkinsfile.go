@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const jenkinsfileName = "Jenkinsfile"
+
+var (
+	pipelineDefinitionPattern = regexp.MustCompile(`(?s)<definition\b[^>]*\bclass="org\.jenkinsci\.plugins\.workflow\.cps\.CpsFlowDefinition"[^>]*>.*?</definition>`)
+	pipelineScriptPattern     = regexp.MustCompile(`(?s)<script>(.*?)</script>|<script/>`)
+)
+
+// findPipelineScript returns the start and end offsets of the <script>
+// element of an inline pipeline definition, or nil.
+func findPipelineScript(config []byte) []int {
+	definition := pipelineDefinitionPattern.FindIndex(config)
+	if definition == nil {
+		return nil
+	}
+	script := pipelineScriptPattern.FindIndex(config[definition[0]:definition[1]])
+	if script == nil {
+		return nil
+	}
+	return []int{definition[0] + script[0], definition[0] + script[1]}
+}
+
+// ExtractPipelineScript moves the inline script of a pipeline job out of its
+// config. It returns the config with an empty <script> element and the
+// script, which is nil for jobs without an inline script or with an empty one.
+func ExtractPipelineScript(config []byte) ([]byte, []byte, error) {
+	location := findPipelineScript(config)
+	if location == nil {
+		return config, nil, nil
+	}
+
+	var script struct {
+		Text string `xml:",chardata"`
+	}
+	err := xml.Unmarshal(config[location[0]:location[1]], &script)
+	if err != nil {
+		return config, nil, err
+	}
+	if strings.TrimSpace(script.Text) == "" {
+		return config, nil, nil
+	}
+
+	var out bytes.Buffer
+	out.Write(config[:location[0]])
+	out.WriteString("<script></script>")
+	out.Write(config[location[1]:])
+	return out.Bytes(), []byte(script.Text), nil
+}
+
+// InjectPipelineScript puts a script back into the empty <script> element of a
+// pipeline config. Configs that still have an inline script are returned as
+// they are.
+func InjectPipelineScript(config []byte, script []byte) []byte {
+	location := findPipelineScript(config)
+	if location == nil {
+		return config
+	}
+	match := pipelineScriptPattern.FindSubmatch(config[location[0]:location[1]])
+	if len(bytes.TrimSpace(match[1])) > 0 {
+		return config
+	}
+
+	var out bytes.Buffer
+	out.Write(config[:location[0]])
+	out.WriteString("<script>")
+	escapeXML(&out, string(script), false)
+	out.WriteString("</script>")
+	out.Write(config[location[1]:])
+	return out.Bytes()
+}
+
+// readJenkinsfile returns the Jenkinsfile next to a job config, or nil if
+// there is none.
+func readJenkinsfile(directory string) ([]byte, error) {
+	script, err := ioutil.ReadFile(directory + "/" + jenkinsfileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return script, err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pipelineJobConfig = `<?xml version='1.1' encoding='UTF-8'?>
+<flow-definition plugin="workflow-job@1289">
+  <description>&lt;script&gt; in a description</description>
+  <definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition" plugin="workflow-cps@3691">
+    <script>node {
+  git url: &apos;https://git.example.com/app.git&apos;, credentialsId: &apos;git-dev&apos;
+  sh &quot;make &amp;&amp; make test &lt; /dev/null&quot;&#xd;
+}</script>
+    <sandbox>true</sandbox>
+  </definition>
+</flow-definition>`
+
+func TestExtractPipelineScript(t *testing.T) {
+	assert := assert.New(t)
+
+	config, script, err := ExtractPipelineScript([]byte(pipelineJobConfig))
+
+	assert.Nil(err)
+	assert.Equal("node {\n  git url: 'https://git.example.com/app.git', credentialsId: 'git-dev'\n  sh \"make && make test < /dev/null\"\r\n}", string(script))
+	assert.Contains(string(config), "<description>&lt;script&gt; in a description</description>")
+	assert.Contains(string(config), "    <script></script>\n    <sandbox>true</sandbox>")
+
+	assert.Equal(pipelineJobConfig, string(InjectPipelineScript(config, script)))
+}
+
+func TestExtractPipelineScript_NoInlineScript(t *testing.T) {
+	config := `<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsScmFlowDefinition"><scriptPath>Jenkinsfile</scriptPath></definition></flow-definition>`
+
+	got, script, err := ExtractPipelineScript([]byte(config))
+
+	assert.Nil(t, err)
+	assert.Nil(t, script)
+	assert.Equal(t, config, string(got))
+	assert.Equal(t, config, string(InjectPipelineScript([]byte(config), []byte("node {}"))))
+}
+
+func TestExtractPipelineScript_EmptyScript(t *testing.T) {
+	for _, config := range []string{
+		`<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script/></definition></flow-definition>`,
+		`<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script></script></definition></flow-definition>`,
+	} {
+		got, script, err := ExtractPipelineScript([]byte(config))
+
+		assert.Nil(t, err)
+		assert.Nil(t, script)
+		assert.Equal(t, config, string(got))
+	}
+}
+
+func TestInjectPipelineScript(t *testing.T) {
+	config := `<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script/></definition></flow-definition>`
+
+	got := InjectPipelineScript([]byte(config), []byte(`echo "a"`))
+	assert.Equal(t, `<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script>echo &quot;a&quot;</script></definition></flow-definition>`, string(got))
+
+	// an inline script takes precedence over a Jenkinsfile
+	assert.Equal(t, string(got), string(InjectPipelineScript(got, []byte("echo b"))))
+}
+
+func TestGetJobConfigForImport_Jenkinsfile(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-jobs")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(directory)
+
+	config, script, _ := ExtractPipelineScript([]byte(pipelineJobConfig))
+	os.MkdirAll(filepath.Join("jobs", "app"), 0755)
+	ioutil.WriteFile(filepath.Join("jobs", "app", "config.xml"), config, 0644)
+	ioutil.WriteFile(filepath.Join("jobs", "app", jenkinsfileName), script, 0644)
+
+	got, err := GetJobConfigForImport("app", ImportOptions{CredentialsMapping: map[string]string{"git-dev": "git-prod"}})
+
+	assert.Nil(err)
+	assert.Contains(string(got), "credentialsId: &apos;git-prod&apos;")
+	assert.Contains(string(got), "sh &quot;make &amp;&amp; make test &lt; /dev/null&quot;&#xd;\n}</script>")
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	jobDSLFile = "jobs.groovy"
+	jcascFile  = "jobs.yaml"
+)
+
+// dslJobConfig holds the parts of the supported job types' config.xml that
+// are converted to Job DSL.
+type dslJobConfig struct {
+	XMLName      xml.Name
+	Description  string `xml:"description"`
+	DisplayName  string `xml:"displayName"`
+	Disabled     bool   `xml:"disabled"`
+	AssignedNode string `xml:"assignedNode"`
+	Definition   struct {
+		Class       string `xml:"class,attr"`
+		Script      string `xml:"script"`
+		Sandbox     bool   `xml:"sandbox"`
+		SCM         dslSCM `xml:"scm"`
+		ScriptPath  string `xml:"scriptPath"`
+		Lightweight bool   `xml:"lightweight"`
+	} `xml:"definition"`
+	SCM      dslSCM `xml:"scm"`
+	Builders struct {
+		Steps []dslBuilder `xml:",any"`
+	} `xml:"builders"`
+	Sources []dslBranchSource `xml:"sources>data>jenkins.branch.BranchSource>source"`
+	Factory struct {
+		ScriptPath string `xml:"scriptPath"`
+	} `xml:"factory"`
+}
+
+type dslSCM struct {
+	Class   string `xml:"class,attr"`
+	Remotes []struct {
+		URL           string `xml:"url"`
+		CredentialsID string `xml:"credentialsId"`
+	} `xml:"userRemoteConfigs>hudson.plugins.git.UserRemoteConfig"`
+	Branches []string `xml:"branches>hudson.plugins.git.BranchSpec>name"`
+}
+
+type dslBuilder struct {
+	XMLName xml.Name
+	Command string `xml:"command"`
+}
+
+type dslBranchSource struct {
+	Class         string `xml:"class,attr"`
+	ID            string `xml:"id"`
+	Remote        string `xml:"remote"`
+	CredentialsID string `xml:"credentialsId"`
+	RepoOwner     string `xml:"repoOwner"`
+	Repository    string `xml:"repository"`
+}
+
+// dslWriter writes indented lines of a Job DSL script.
+type dslWriter struct {
+	builder strings.Builder
+	depth   int
+}
+
+func (writer *dslWriter) line(format string, args ...interface{}) {
+	writer.builder.WriteString(strings.Repeat("    ", writer.depth))
+	fmt.Fprintf(&writer.builder, format, args...)
+	writer.builder.WriteString("\n")
+}
+
+func (writer *dslWriter) open(format string, args ...interface{}) {
+	writer.line(format+" {", args...)
+	writer.depth++
+}
+
+func (writer *dslWriter) close() {
+	writer.depth--
+	writer.line("}")
+}
+
+// groovyLiteral quotes a value as a Groovy single quoted string, which is not
+// interpolated, so ${...} in scripts stays as it is.
+func groovyLiteral(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\r", `\r`).Replace(value)
+	if strings.Contains(value, "\n") {
+		return "'''" + escaped + "'''"
+	}
+	return "'" + escaped + "'"
+}
+
+func writeDSLCommon(writer *dslWriter, config dslJobConfig) {
+	if config.DisplayName != "" {
+		writer.line("displayName(%s)", groovyLiteral(config.DisplayName))
+	}
+	if config.Description != "" {
+		writer.line("description(%s)", groovyLiteral(config.Description))
+	}
+	if config.Disabled {
+		writer.line("disabled()")
+	}
+}
+
+func writeDSLGit(writer *dslWriter, scm dslSCM) error {
+	if scm.Class != "hudson.plugins.git.GitSCM" {
+		return fmt.Errorf("SCM %s is not supported", scm.Class)
+	}
+	writer.open("scm")
+	writer.open("git")
+	for _, remote := range scm.Remotes {
+		writer.open("remote")
+		writer.line("url(%s)", groovyLiteral(remote.URL))
+		if remote.CredentialsID != "" {
+			writer.line("credentials(%s)", groovyLiteral(remote.CredentialsID))
+		}
+		writer.close()
+	}
+	for _, branch := range scm.Branches {
+		writer.line("branch(%s)", groovyLiteral(branch))
+	}
+	writer.close()
+	writer.close()
+	return nil
+}
+
+func writeDSLPipelineJob(writer *dslWriter, name string, config dslJobConfig) error {
+	writer.open("pipelineJob(%s)", groovyLiteral(name))
+	writeDSLCommon(writer, config)
+	writer.open("definition")
+	switch config.Definition.Class {
+	case "org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition":
+		writer.open("cps")
+		writer.line("script(%s)", groovyLiteral(config.Definition.Script))
+		writer.line("sandbox(%t)", config.Definition.Sandbox)
+		writer.close()
+	case "org.jenkinsci.plugins.workflow.cps.CpsScmFlowDefinition":
+		writer.open("cpsScm")
+		err := writeDSLGit(writer, config.Definition.SCM)
+		if err != nil {
+			return err
+		}
+		writer.line("scriptPath(%s)", groovyLiteral(config.Definition.ScriptPath))
+		writer.line("lightweight(%t)", config.Definition.Lightweight)
+		writer.close()
+	default:
+		return fmt.Errorf("Pipeline definition %s is not supported", config.Definition.Class)
+	}
+	writer.close()
+	writer.close()
+	return nil
+}
+
+func writeDSLMultibranchJob(writer *dslWriter, name string, config dslJobConfig) error {
+	writer.open("multibranchPipelineJob(%s)", groovyLiteral(name))
+	writeDSLCommon(writer, config)
+	writer.open("branchSources")
+	for _, source := range config.Sources {
+		switch source.Class {
+		case "jenkins.plugins.git.GitSCMSource":
+			writer.open("git")
+			writer.line("id(%s)", groovyLiteral(source.ID))
+			writer.line("remote(%s)", groovyLiteral(source.Remote))
+			if source.CredentialsID != "" {
+				writer.line("credentialsId(%s)", groovyLiteral(source.CredentialsID))
+			}
+			writer.close()
+		case "org.jenkinsci.plugins.github_branch_source.GitHubSCMSource":
+			writer.open("github")
+			writer.line("id(%s)", groovyLiteral(source.ID))
+			writer.line("repoOwner(%s)", groovyLiteral(source.RepoOwner))
+			writer.line("repository(%s)", groovyLiteral(source.Repository))
+			if source.CredentialsID != "" {
+				writer.line("scanCredentialsId(%s)", groovyLiteral(source.CredentialsID))
+			}
+			writer.close()
+		default:
+			return fmt.Errorf("Branch source %s is not supported", source.Class)
+		}
+	}
+	writer.close()
+	if config.Factory.ScriptPath != "" {
+		writer.open("factory")
+		writer.open("workflowBranchProjectFactory")
+		writer.line("scriptPath(%s)", groovyLiteral(config.Factory.ScriptPath))
+		writer.close()
+		writer.close()
+	}
+	writer.close()
+	return nil
+}
+
+// writeDSLFreestyleJob fails on builders without a Job DSL counterpart. With
+// allowPartial they are left as comments and reported on STDERR instead.
+func writeDSLFreestyleJob(writer *dslWriter, name string, config dslJobConfig, allowPartial bool) error {
+	writer.open("job(%s)", groovyLiteral(name))
+	writeDSLCommon(writer, config)
+	if config.AssignedNode != "" {
+		writer.line("label(%s)", groovyLiteral(config.AssignedNode))
+	}
+	if config.SCM.Class != "" && config.SCM.Class != "hudson.scm.NullSCM" {
+		err := writeDSLGit(writer, config.SCM)
+		if err != nil {
+			return err
+		}
+	}
+	if len(config.Builders.Steps) > 0 {
+		writer.open("steps")
+		for _, step := range config.Builders.Steps {
+			switch step.XMLName.Local {
+			case "hudson.tasks.Shell":
+				writer.line("shell(%s)", groovyLiteral(step.Command))
+			case "hudson.tasks.BatchFile":
+				writer.line("batchFile(%s)", groovyLiteral(step.Command))
+			default:
+				if !allowPartial {
+					return fmt.Errorf("Builder %s is not supported", step.XMLName.Local)
+				}
+				fmt.Fprintf(os.Stderr, "Job %s: builder %s is not supported, left as a comment\n", name, step.XMLName.Local)
+				writer.line("// builder %s is not supported", step.XMLName.Local)
+			}
+		}
+		writer.close()
+	}
+	writer.close()
+	return nil
+}
+
+// ConvertJobToDSL converts the config.xml of a pipeline, multibranch,
+// folder or freestyle job to a Job DSL script. With allowPartial, freestyle
+// jobs with unsupported builders are converted without them.
+func ConvertJobToDSL(name string, data []byte, allowPartial bool) (string, error) {
+	var config dslJobConfig
+	err := xml.Unmarshal(xmlDeclarationPattern.ReplaceAll(data, []byte{}), &config)
+	if err != nil {
+		return "", err
+	}
+
+	writer := &dslWriter{}
+	switch config.XMLName.Local {
+	case "flow-definition":
+		err = writeDSLPipelineJob(writer, name, config)
+	case "org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject":
+		err = writeDSLMultibranchJob(writer, name, config)
+	case "com.cloudbees.hudson.plugins.folder.Folder":
+		writer.open("folder(%s)", groovyLiteral(name))
+		writeDSLCommon(writer, config)
+		writer.close()
+	case "project":
+		err = writeDSLFreestyleJob(writer, name, config, allowPartial)
+	default:
+		err = fmt.Errorf("Job type %s is not supported", config.XMLName.Local)
+	}
+	if err != nil {
+		return "", err
+	}
+	return writer.builder.String(), nil
+}
+
+// GetJCasCJobs returns a Configuration-as-Code jobs section running the Job
+// DSL scripts.
+func GetJCasCJobs(scripts []string) ([]byte, error) {
+	var casc struct {
+		Jobs []map[string]string `yaml:"jobs"`
+	}
+	for _, script := range scripts {
+		casc.Jobs = append(casc.Jobs, map[string]string{"script": script})
+	}
+	return yaml.Marshal(casc)
+}
+
+// writeJobsAsCode writes the converted jobs to jobs.groovy or jobs.yaml.
+func writeJobsAsCode(scripts []string, format string) error {
+	if format == "jcasc" {
+		data, err := GetJCasCJobs(scripts)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(jcascFile, data, 0644)
+	}
+	return ioutil.WriteFile(jobDSLFile, []byte(strings.Join(scripts, "\n")), 0644)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertJobToDSL_Pipeline(t *testing.T) {
+	got, err := ConvertJobToDSL("team/app", []byte(pipelineJobConfig), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `pipelineJob('team/app') {
+    description('<script> in a description')
+    definition {
+        cps {
+            script('''node {
+  git url: \'https://git.example.com/app.git\', credentialsId: \'git-dev\'
+  sh "make && make test < /dev/null"\r
+}''')
+            sandbox(true)
+        }
+    }
+}
+`, got)
+}
+
+func TestConvertJobToDSL_PipelineFromSCM(t *testing.T) {
+	config := `<?xml version='1.1' encoding='UTF-8'?>
+<flow-definition plugin="workflow-job@1289">
+  <disabled>true</disabled>
+  <definition class="org.jenkinsci.plugins.workflow.cps.CpsScmFlowDefinition" plugin="workflow-cps@3691">
+    <scm class="hudson.plugins.git.GitSCM" plugin="git@5.2.0">
+      <userRemoteConfigs>
+        <hudson.plugins.git.UserRemoteConfig>
+          <url>https://git.example.com/app.git</url>
+          <credentialsId>git</credentialsId>
+        </hudson.plugins.git.UserRemoteConfig>
+      </userRemoteConfigs>
+      <branches>
+        <hudson.plugins.git.BranchSpec>
+          <name>*/main</name>
+        </hudson.plugins.git.BranchSpec>
+      </branches>
+    </scm>
+    <scriptPath>ci/Jenkinsfile</scriptPath>
+    <lightweight>true</lightweight>
+  </definition>
+</flow-definition>`
+
+	got, err := ConvertJobToDSL("app", []byte(config), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `pipelineJob('app') {
+    disabled()
+    definition {
+        cpsScm {
+            scm {
+                git {
+                    remote {
+                        url('https://git.example.com/app.git')
+                        credentials('git')
+                    }
+                    branch('*/main')
+                }
+            }
+            scriptPath('ci/Jenkinsfile')
+            lightweight(true)
+        }
+    }
+}
+`, got)
+}
+
+func TestConvertJobToDSL_Multibranch(t *testing.T) {
+	config := `<org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject plugin="workflow-multibranch@773">
+  <displayName>App</displayName>
+  <sources class="jenkins.branch.MultiBranchProject$BranchSourceList" plugin="branch-api@2.1135">
+    <data>
+      <jenkins.branch.BranchSource>
+        <source class="jenkins.plugins.git.GitSCMSource" plugin="git@5.2.0">
+          <id>4f3c</id>
+          <remote>https://git.example.com/app.git</remote>
+          <credentialsId>git</credentialsId>
+        </source>
+      </jenkins.branch.BranchSource>
+    </data>
+  </sources>
+  <factory class="org.jenkinsci.plugins.workflow.multibranch.WorkflowBranchProjectFactory">
+    <scriptPath>Jenkinsfile</scriptPath>
+  </factory>
+</org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject>`
+
+	got, err := ConvertJobToDSL("app", []byte(config), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `multibranchPipelineJob('app') {
+    displayName('App')
+    branchSources {
+        git {
+            id('4f3c')
+            remote('https://git.example.com/app.git')
+            credentialsId('git')
+        }
+    }
+    factory {
+        workflowBranchProjectFactory {
+            scriptPath('Jenkinsfile')
+        }
+    }
+}
+`, got)
+}
+
+func TestConvertJobToDSL_Freestyle(t *testing.T) {
+	config := `<project>
+  <description>Nightly</description>
+  <assignedNode>linux</assignedNode>
+  <scm class="hudson.scm.NullSCM"/>
+  <builders>
+    <hudson.tasks.Shell>
+      <command>echo "${BUILD_ID}"
+make</command>
+    </hudson.tasks.Shell>
+    <hudson.tasks.BatchFile>
+      <command>build.bat</command>
+    </hudson.tasks.BatchFile>
+    <hudson.tasks.Maven>
+      <targets>install</targets>
+    </hudson.tasks.Maven>
+  </builders>
+</project>`
+
+	_, err := ConvertJobToDSL("nightly", []byte(config), false)
+	assert.EqualError(t, err, "Builder hudson.tasks.Maven is not supported")
+
+	got, err := ConvertJobToDSL("nightly", []byte(config), true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `job('nightly') {
+    description('Nightly')
+    label('linux')
+    steps {
+        shell('''echo "${BUILD_ID}"
+make''')
+        batchFile('build.bat')
+        // builder hudson.tasks.Maven is not supported
+    }
+}
+`, got)
+}
+
+func TestConvertJobToDSL_Folder(t *testing.T) {
+	got, err := ConvertJobToDSL("team", []byte(`<com.cloudbees.hudson.plugins.folder.Folder plugin="cloudbees-folder@6.9"><description>Team's jobs</description></com.cloudbees.hudson.plugins.folder.Folder>`), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "folder('team') {\n    description('Team\\'s jobs')\n}\n", got)
+}
+
+func TestConvertJobToDSL_Unsupported(t *testing.T) {
+	_, err := ConvertJobToDSL("matrix", []byte(`<matrix-project/>`), false)
+
+	assert.EqualError(t, err, "Job type matrix-project is not supported")
+}
+
+func TestGetJCasCJobs(t *testing.T) {
+	got, err := GetJCasCJobs([]string{"folder('team') {\n}\n"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "jobs:\n- script: |\n    folder('team') {\n    }\n", string(got))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"strings"
 )
@@ -74,6 +75,24 @@ func (jobList *JobList) GetSubfoldersRecursively() (JobList, error) {
 	return subfolders, nil
 }
 
+func (jobList *JobList) GetJobsRecursively() (JobList, error) {
+	var jobs = JobList{Jobs: append([]Job{}, jobList.Jobs...)}
+
+	for _, innerfolder := range jobList.GetSubfolders().Jobs {
+		allJobsOfInnerFolder, err := innerfolder.GetJobs()
+		if err != nil {
+			return jobs, err
+		}
+		recursiveJobs, err := allJobsOfInnerFolder.GetJobsRecursively()
+		if err != nil {
+			return jobs, err
+		}
+		jobs.Jobs = append(jobs.Jobs, recursiveJobs.Jobs...)
+	}
+
+	return jobs, nil
+}
+
 func (job *Job) GetJobs() (JobList, error) {
 	url := fmt.Sprintf("%s/api/xml", job.URL)
 
@@ -163,7 +182,19 @@ func ListFolders(server string, folderName string, username string, password str
 	return nil
 }
 
-func ExportJobs(server string, folderName string, username string, password string, skipFolder bool) error {
+// ExportOptions controls how job configs are written when they are exported.
+type ExportOptions struct {
+	Normalize           bool
+	StripPluginVersions bool
+	ExtractScripts      bool
+	// Format is xml, job-dsl or jcasc
+	Format string
+	// AllowPartial converts freestyle jobs with unsupported builders to Job
+	// DSL without them instead of skipping the jobs
+	AllowPartial bool
+}
+
+func ExportJobs(server string, folderName string, username string, password string, skipFolder bool, options ExportOptions) error {
 	httpClient := &JenkinsHTTPClient{
 		BasicAuthSettings: BasicAuthSettings{
 			Username: username,
@@ -180,6 +211,14 @@ func ExportJobs(server string, folderName string, username string, password stri
 		jobs = jobs.WithoutFolders()
 	}
 
+	switch options.Format {
+	case "", "xml":
+	case "job-dsl", "jcasc":
+		return ExportJobsAsCode(jobs, folderName, username, password, options.Format, options.AllowPartial)
+	default:
+		return fmt.Errorf("Unknown format %q, expected xml, job-dsl or jcasc", options.Format)
+	}
+
 	var directory = "jobs"
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		os.Mkdir(directory, 0755)
@@ -187,7 +226,7 @@ func ExportJobs(server string, folderName string, username string, password stri
 
 	for _, job := range jobs.Jobs {
 		fmt.Printf("Exporting job: %s\n", job.Name)
-		err := ExportJob(job, username, password)
+		err := ExportJob(job, username, password, options)
 		if err != nil {
 			return err
 		}
@@ -195,38 +234,93 @@ func ExportJobs(server string, folderName string, username string, password stri
 	return nil
 }
 
-func ExportJob(job Job, username string, password string) error {
+// ExportJobsAsCode converts the jobs to Job DSL scripts, written to a single
+// jobs.groovy or, for jcasc, to the jobs section of jobs.yaml. Jobs that can't
+// be converted are skipped and reported on STDERR.
+func ExportJobsAsCode(jobs JobList, folderName string, username string, password string, format string, allowPartial bool) error {
+	scripts := make([]string, 0)
+	for _, job := range jobs.Jobs {
+		fmt.Printf("Exporting job: %s\n", job.Name)
+		data, err := GetJobConfig(job, username, password)
+		if err != nil {
+			return err
+		}
+
+		name := job.Name
+		if folderName != "" {
+			name = strings.Trim(folderName, "/") + "/" + job.Name
+		}
+		script, err := ConvertJobToDSL(name, data, allowPartial)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Job %s couldn't be converted, skipped: %v\n", name, err)
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+
+	return writeJobsAsCode(scripts, format)
+}
+
+func GetJobConfig(job Job, username string, password string) ([]byte, error) {
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", job.URL+"/config.xml", nil)
 	req.SetBasicAuth(username, password)
 	if err != nil {
-		return err
+		return []byte{}, err
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return []byte{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 401 {
-		return errors.New("Unauthorized 401")
+		return []byte{}, errors.New("Unauthorized 401")
 	}
 
 	if resp.StatusCode != 200 {
-		return errors.New("Job couldn't not be exported")
+		return []byte{}, errors.New("Job couldn't not be exported")
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	return ioutil.ReadAll(resp.Body)
+}
+
+func ExportJob(job Job, username string, password string, options ExportOptions) error {
+	data, err := GetJobConfig(job, username, password)
 	if err != nil {
 		return err
 	}
 
+	if options.Normalize || options.StripPluginVersions {
+		normalized, err := NormalizeJobConfig(data, options.StripPluginVersions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\tConfig couldn't be normalized, exporting it as is: %v\n", err)
+		} else {
+			data = normalized
+		}
+	}
+
 	var directory = "jobs/" + job.Name
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		os.Mkdir(directory, 0755)
 	}
 
+	if options.ExtractScripts {
+		var script []byte
+		data, script, err = ExtractPipelineScript(data)
+		if err != nil {
+			return err
+		}
+		if script != nil {
+			err = ioutil.WriteFile(directory+"/"+jenkinsfileName, script, 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\tPipeline script extracted to %s.\n", jenkinsfileName)
+		}
+	}
+
 	f, err := os.Create("jobs/" + job.Name + "/config.xml")
 	if err != nil {
 		return err
@@ -273,7 +367,96 @@ func GetCrumb(host string, username string, password string) ([]string, error) {
 	return strings.Split(string(data), ":"), nil
 }
 
-func ImportJobs(server string, username string, password string, folder string) error {
+// getConfigXML returns the config.xml of the job, view or node at url.
+func getConfigXML(url string, username string, password string) ([]byte, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url+"/config.xml", nil)
+	if err != nil {
+		return []byte{}, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return []byte{}, errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return []byte{}, fmt.Errorf("%s/config.xml cannot be read: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// postConfigXML posts an XML document, like a new config.xml, to url.
+func postConfigXML(server string, url string, username string, password string, config []byte) error {
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(config))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+	req.Header.Set("Content-Type", "text/xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s failed: %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// itemExists tells whether the job, view or node at url exists.
+func itemExists(url string, username string, password string) (bool, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url+"/api/json", nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return false, errors.New("Unauthorized 401")
+	}
+
+	return resp.StatusCode == 200, nil
+}
+
+// ImportOptions controls how exported job configs are rewritten before they
+// are posted to Jenkins.
+type ImportOptions struct {
+	CredentialsMapping map[string]string
+	Values             map[string]interface{}
+}
+
+func ImportJobs(server string, username string, password string, folder string, options ImportOptions) error {
 	jobs, err := ioutil.ReadDir("jobs")
 	if err != nil {
 		return err
@@ -281,7 +464,7 @@ func ImportJobs(server string, username string, password string, folder string)
 
 	for _, job := range jobs {
 		fmt.Printf("Import job: %s\n", job.Name())
-		err := ImportJob(job.Name(), folder, server, username, password)
+		err := ImportJob(job.Name(), folder, server, username, password, options)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -290,13 +473,18 @@ func ImportJobs(server string, username string, password string, folder string)
 	return nil
 }
 
-func ImportJob(name string, folderName string, server string, username string, password string) error {
-	jsonStr, err := ioutil.ReadFile("jobs/" + name + "/config.xml")
+func ImportJob(name string, folderName string, server string, username string, password string, options ImportOptions) error {
+	config, err := GetJobConfigForImport(name, options)
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s/createItem?name=%s", GetFolderURL(server, folderName), name)
+	return CreateJob(server, folderName, name, username, password, config)
+}
+
+// CreateJob creates a job, or a folder, from its config in folderName.
+func CreateJob(server string, folderName string, name string, username string, password string, jsonStr []byte) error {
+	url := fmt.Sprintf("%s/createItem?name=%s", GetFolderURL(server, folderName), neturl.QueryEscape(name))
 	client := &http.Client{}
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
 	if err != nil {
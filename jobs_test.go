@@ -1,7 +1,14 @@
 package main
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -172,3 +179,69 @@ func TestJob_getFolderName(t *testing.T) {
 		})
 	}
 }
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Form   url.Values
+	Body   string
+}
+
+// testJenkinsServer fakes Jenkins for tests: it issues a crumb, serves the
+// given routes by cleaned path and answers 404 otherwise. Every request
+// other than a GET is recorded, with its query and form values in Form.
+type testJenkinsServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []recordedRequest
+}
+
+func newTestJenkinsServer(routes map[string]http.HandlerFunc) *testJenkinsServer {
+	server := &testJenkinsServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/xml" {
+			w.Write([]byte("Jenkins-Crumb:abc"))
+			return
+		}
+
+		if r.Method != "GET" {
+			body, _ := ioutil.ReadAll(r.Body)
+			form := r.URL.Query()
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				values, _ := url.ParseQuery(string(body))
+				for key, value := range values {
+					form[key] = append(form[key], value...)
+				}
+			}
+			server.mutex.Lock()
+			server.requests = append(server.requests, recordedRequest{r.Method, r.URL.Path, form, string(body)})
+			server.mutex.Unlock()
+			r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		}
+
+		route, ok := routes[path.Clean(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		route(w, r)
+	}))
+	return server
+}
+
+// Requests returns the recorded requests to any of the given paths, in the
+// order they were made.
+func (server *testJenkinsServer) Requests(paths ...string) []recordedRequest {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	var requests []recordedRequest
+	for _, request := range server.requests {
+		for _, path := range paths {
+			if request.Path == path {
+				requests = append(requests, request)
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -25,6 +25,56 @@ func main() {
 			Email: "dominik.schroeter@bmw.de",
 		},
 	}
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "servers",
+			Usage:  "Run the command on every server of a comma separated list of urls or configured servers",
+			EnvVar: "JENKINS_SERVERS",
+		},
+		cli.StringFlag{
+			Name:  "profile-group",
+			Usage: "Run the command on every server of a group from the config file",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Config file with servers and profile groups",
+			Value:  getDefaultConfigPath(),
+			EnvVar: "BUTLER_CONFIG",
+		},
+		cli.IntFlag{
+			Name:  "parallel",
+			Usage: "Maximum number of servers to run on at once, 0 for all",
+		},
+		cli.BoolFlag{
+			Name:  "per-server-dir",
+			Usage: "Run the command on every server in a directory named after the server",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		if IsFanOutChild() || c.String("servers") == "" && c.String("profile-group") == "" {
+			return nil
+		}
+		if c.NArg() == 0 {
+			return cli.NewExitError("A command is required with --servers or --profile-group", 1)
+		}
+
+		config, err := LoadConfig(c.String("config"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		targets, err := ResolveTargets(config, c.String("servers"), c.String("profile-group"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		if len(targets) == 0 {
+			return cli.NewExitError("No servers to run on", 1)
+		}
+
+		// the command runs once per server, the fan-out replaces this run
+		os.Exit(FanOut(targets, c.Args(), c.Bool("per-server-dir"), c.Int("parallel")))
+		return nil
+	}
 	app.Commands = []cli.Command{
 		{
 			Name:  "jobs",
@@ -54,6 +104,18 @@ func main() {
 							Name:  "folder, f",
 							Usage: "Jenkins Folder",
 						},
+						cli.StringSliceFlag{
+							Name:  "map",
+							Usage: "Rewrite credential ID references (old-id=new-id), may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "map-file",
+							Usage: "YAML file mapping old credential IDs to new ones",
+						},
+						cli.StringFlag{
+							Name:  "values",
+							Usage: "YAML file with the values to render the config.xml templates with",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						var server = getSanitizedUrl(c.String("server"))
@@ -66,7 +128,48 @@ func main() {
 							return nil
 						}
 
-						err := ImportJobs(server, username, password, folder)
+						options, err := getImportOptions(c)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						err = ImportJobs(server, username, password, folder, options)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "render",
+					Usage:     "Preview exported Jenkins Jobs as they would be imported",
+					ArgsUsage: "[job...]",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "map",
+							Usage: "Rewrite credential ID references (old-id=new-id), may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "map-file",
+							Usage: "YAML file mapping old credential IDs to new ones",
+						},
+						cli.StringFlag{
+							Name:  "values",
+							Usage: "YAML file with the values to render the config.xml templates with",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "Directory to write the rendered jobs to instead of printing them",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						options, err := getImportOptions(c)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						err = RenderJobs(c.Args(), options, c.String("output"))
 						if err != nil {
 							return cli.NewExitError(err.Error(), 1)
 						}
@@ -103,6 +206,27 @@ func main() {
 							Usage:  "Skip folder",
 							EnvVar: "JENKINS_SKIP_FOLDER",
 						},
+						cli.BoolFlag{
+							Name:  "normalize",
+							Usage: "Canonicalize the exported config.xml files for stable diffs",
+						},
+						cli.BoolFlag{
+							Name:  "strip-plugin-versions",
+							Usage: "Remove plugin versions from the exported config.xml files, implies --normalize",
+						},
+						cli.BoolFlag{
+							Name:  "extract-scripts",
+							Usage: "Write inline pipeline scripts to a Jenkinsfile next to config.xml",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (xml, job-dsl, jcasc)",
+							Value: "xml",
+						},
+						cli.BoolFlag{
+							Name:  "allow-partial",
+							Usage: "Convert freestyle jobs with unsupported builders to Job DSL without them",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						var server = getSanitizedUrl(c.String("server"))
@@ -115,11 +239,91 @@ func main() {
 							cli.ShowSubcommandHelp(c)
 						}
 
-						err := ExportJobs(server, folder, username, password, skipFolder)
+						options := ExportOptions{
+							Normalize:           c.Bool("normalize"),
+							StripPluginVersions: c.Bool("strip-plugin-versions"),
+							ExtractScripts:      c.Bool("extract-scripts"),
+							Format:              c.String("format"),
+							AllowPartial:        c.Bool("allow-partial"),
+						}
+
+						err := ExportJobs(server, folder, username, password, skipFolder, options)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "build",
+					Usage:     "Trigger a build of a Jenkins Job",
+					Aliases:   []string{"b"},
+					ArgsUsage: "<job path>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringSliceFlag{
+							Name:  "param",
+							Usage: "Build parameter (name=value), may be repeated",
+						},
+						cli.BoolFlag{
+							Name:  "wait, w",
+							Usage: "Wait for the build and exit with its result",
+						},
+						cli.BoolFlag{
+							Name:  "follow",
+							Usage: "Stream the console log of the build, implies --wait",
+						},
+						cli.DurationFlag{
+							Name:  "timeout",
+							Usage: "Maximum time to wait for the build to start and to finish, 0 to wait forever",
+							Value: time.Hour,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" || c.NArg() != 1 {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						parameters, err := ParseScriptArguments(c.StringSlice("param"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						options := BuildOptions{
+							Parameters: parameters,
+							Wait:       c.Bool("wait"),
+							Follow:     c.Bool("follow"),
+							Timeout:    c.Duration("timeout"),
+						}
+						result, err := BuildJob(server, c.Args().First(), username, password, options)
 						if err != nil {
 							return cli.NewExitError(err.Error(), 1)
 						}
 
+						if code := GetBuildExitCode(result); result != "" && code != 0 {
+							return cli.NewExitError(fmt.Sprintf("Build finished with %s", result), code)
+						}
+
 						return nil
 					},
 				},
@@ -179,7 +383,7 @@ func main() {
 			Subcommands: []cli.Command{
 				{
 					Name:    "decrypt",
-					Usage:   "Decrypt credentials of Jenkins folder",
+					Usage:   "Decrypt credentials of Jenkins folder (or global credentials without folder)",
 					Aliases: []string{"d"},
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -201,6 +405,97 @@ func main() {
 							Usage:  "Jenkins password",
 							EnvVar: "JENKINS_PASSWORD",
 						},
+						cli.BoolFlag{
+							Name:  "recursive, r",
+							Usage: "All folders below --folder (or the root), keyed by folder full name",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "Write credentials to file instead of STDOUT",
+						},
+						cli.StringSliceFlag{
+							Name:  "encrypt-to",
+							Usage: "Encrypt credentials for age recipient (age1...), may be repeated",
+						},
+						cli.StringFlag{
+							Name:   "passphrase",
+							Usage:  "Encrypt credentials with passphrase",
+							EnvVar: "BUTLER_PASSPHRASE",
+						},
+						cli.BoolFlag{
+							Name:  "plaintext",
+							Usage: "Print plaintext credentials even if STDOUT is a terminal",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var url = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var folder = c.String("folder")
+
+						if url == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						out, err := OpenCredentialsOutput(c.String("output"), c.StringSlice("encrypt-to"), c.String("passphrase"), c.Bool("plaintext"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						if c.Bool("recursive") {
+							err = DecryptFolderCredentialsRecursively(url, folder, username, password, out)
+						} else if folder == "" {
+							err = DecryptSystemCredentials(url, username, password, out)
+						} else {
+							err = DecryptFolderCredentials(url, folder, username, password, out)
+						}
+						if err != nil {
+							out.Close()
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						err = out.Close()
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "list",
+					Usage:   "List credentials of Jenkins folder (or global credentials without folder) without secrets",
+					Aliases: []string{"l"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server",
+							Usage:  "Jenkins url",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:  "folder, f",
+							Usage: "Jenkins Folder",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.BoolFlag{
+							Name:  "recursive, r",
+							Usage: "Include all folders below --folder (or the root)",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json)",
+							Value: "table",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						var url = getSanitizedUrl(c.String("server"))
@@ -208,12 +503,12 @@ func main() {
 						var password = c.String("password")
 						var folder = c.String("folder")
 
-						if url == "" || folder == "" {
+						if url == "" {
 							cli.ShowSubcommandHelp(c)
 							return nil
 						}
 
-						err := DecryptFolderCredentials(url, folder, username, password)
+						err := ListCredentials(url, folder, username, password, c.Bool("recursive"), c.String("format"))
 						if err != nil {
 							return cli.NewExitError(err.Error(), 1)
 						}
@@ -223,7 +518,7 @@ func main() {
 				},
 				{
 					Name:    "apply",
-					Usage:   "Apply (from STDIN) credentials of Jenkins folder",
+					Usage:   "Apply (from STDIN) credentials of Jenkins folder (or global credentials without folder)",
 					Aliases: []string{"a"},
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -245,6 +540,31 @@ func main() {
 							Usage:  "Jenkins password",
 							EnvVar: "JENKINS_PASSWORD",
 						},
+						cli.BoolFlag{
+							Name:  "recursive, r",
+							Usage: "All folders below --folder (or the root), keyed by folder full name",
+						},
+						cli.StringFlag{
+							Name:  "input, i",
+							Usage: "Read credentials from file instead of STDIN",
+						},
+						cli.StringSliceFlag{
+							Name:  "identity",
+							Usage: "age identity file to decrypt encrypted credentials, may be repeated",
+						},
+						cli.StringFlag{
+							Name:   "passphrase",
+							Usage:  "Passphrase to decrypt encrypted credentials",
+							EnvVar: "BUTLER_PASSPHRASE",
+						},
+						cli.StringSliceFlag{
+							Name:  "map",
+							Usage: "Rename credential ID (old-id=new-id), may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "map-file",
+							Usage: "YAML file mapping old credential IDs to new ones",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						var url = getSanitizedUrl(c.String("server"))
@@ -252,12 +572,26 @@ func main() {
 						var password = c.String("password")
 						var folder = c.String("folder")
 
-						if url == "" || folder == "" {
+						if url == "" {
 							cli.ShowSubcommandHelp(c)
 							return nil
 						}
 
-						err := ApplyFolderCredentials(url, folder, username, password)
+						mapping, err := ParseCredentialsMapping(c.StringSlice("map"), c.String("map-file"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						in, err := OpenCredentialsInput(c.String("input"), c.StringSlice("identity"), c.String("passphrase"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						if c.Bool("recursive") {
+							err = ApplyFolderCredentialsRecursively(url, folder, username, password, in, mapping)
+						} else {
+							err = ApplyFolderCredentials(url, folder, username, password, in, mapping)
+						}
 						if err != nil {
 							return cli.NewExitError(err.Error(), 1)
 						}
@@ -291,17 +625,30 @@ func main() {
 							Usage:  "Jenkins password",
 							EnvVar: "JENKINS_PASSWORD",
 						},
+						cli.StringFlag{
+							Name:  "from-dir",
+							Usage: "Upload .hpi/.jpi files from directory instead of installing plugins.txt",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						var server = getSanitizedUrl(c.String("server"))
 						var username = c.String("username")
 						var password = c.String("password")
+						var fromDir = c.String("from-dir")
 
 						if server == "" {
 							cli.ShowSubcommandHelp(c)
 							return nil
 						}
 
+						if fromDir != "" {
+							err := ImportPluginFiles(server, username, password, fromDir)
+							if err != nil {
+								return cli.NewExitError(err.Error(), 1)
+							}
+							return nil
+						}
+
 						err := ImportPlugins(server, username, password)
 						if err != nil {
 							return cli.NewExitError(err.Error(), 1)
@@ -348,13 +695,983 @@ func main() {
 						return nil
 					},
 				},
-			},
-		},
-	}
-	app.CommandNotFound = func(c *cli.Context, command string) {
-		fmt.Fprintf(c.App.Writer, "Command not found %q !", command)
-	}
-	app.Run(os.Args)
+				{
+					Name:    "download",
+					Usage:   "Download plugin files listed in plugins.txt",
+					Aliases: []string{"d"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "mirror, m",
+							Usage:  "Plugin download mirror",
+							Value:  "https://updates.jenkins.io/download",
+							EnvVar: "JENKINS_UC_DOWNLOAD",
+						},
+						cli.StringFlag{
+							Name:  "directory, d",
+							Usage: "Target directory",
+							Value: "hpis",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var mirror = c.String("mirror")
+						var directory = c.String("directory")
+
+						err := DownloadPlugins(mirror, directory)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "enable",
+					Usage:     "Enable Jenkins Plugins",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var force = false
+
+						if server == "" || !c.Args().Present() {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ManagePlugins(server, username, password, "enable", c.Args(), force)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "disable",
+					Usage:     "Disable Jenkins Plugins",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "Ignore plugins depending on it",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var force = c.Bool("force")
+
+						if server == "" || !c.Args().Present() {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ManagePlugins(server, username, password, "disable", c.Args(), force)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "uninstall",
+					Usage:     "Uninstall Jenkins Plugins",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "Ignore plugins depending on it",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var force = c.Bool("force")
+
+						if server == "" || !c.Args().Present() {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ManagePlugins(server, username, password, "uninstall", c.Args(), force)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "unused",
+					Usage:   "List Jenkins Plugins no job or plugin depends on",
+					Aliases: []string{"u"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "from-dir",
+							Usage: "Read job configs from an export directory (e.g. jobs) instead of the server",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var fromDir = c.String("from-dir")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ListUnusedPlugins(server, username, password, fromDir)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "audit",
+					Usage:   "Audit Jenkins Plugins for security warnings",
+					Aliases: []string{"a"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "fail-on",
+							Usage: "Exit non-zero on warnings at or above severity (low, medium, high, critical). Warnings without severity count as critical",
+						},
+						cli.StringFlag{
+							Name:  "advisory-db",
+							Usage: "OSV API to read the severity of warnings from, empty to skip",
+							Value: DefaultAdvisoryDatabase,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var failOn = c.String("fail-on")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := AuditPlugins(server, username, password, failOn, c.String("advisory-db"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "views",
+			Usage: "Jenkins Views Management",
+			Subcommands: []cli.Command{
+				{
+					Name:    "export",
+					Usage:   "Export Jenkins Views",
+					Aliases: []string{"e"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "folder, f",
+							Usage: "Jenkins Folder",
+						},
+						cli.StringFlag{
+							Name:  "directory, d",
+							Usage: "Directory of the views",
+							Value: "views",
+						},
+						cli.BoolFlag{
+							Name:  "recursive, r",
+							Usage: "Views of all folders below --folder (or the root), mirroring the folder tree",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var folder = c.String("folder")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						var err error
+						if c.Bool("recursive") {
+							err = ExportViewsRecursively(server, folder, username, password, c.String("directory"))
+						} else {
+							err = ExportViews(server, folder, username, password, c.String("directory"))
+						}
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "import",
+					Usage:   "Import (create or update) Jenkins Views",
+					Aliases: []string{"i"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "folder, f",
+							Usage: "Jenkins Folder",
+						},
+						cli.StringFlag{
+							Name:  "directory, d",
+							Usage: "Directory of the views",
+							Value: "views",
+						},
+						cli.BoolFlag{
+							Name:  "recursive, r",
+							Usage: "Views of all folders below --folder (or the root), mirroring the folder tree",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var folder = c.String("folder")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						var err error
+						if c.Bool("recursive") {
+							err = ImportViewsRecursively(server, folder, username, password, c.String("directory"))
+						} else {
+							err = ImportViews(server, folder, username, password, c.String("directory"))
+						}
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "nodes",
+			Usage: "Jenkins Nodes Management",
+			Subcommands: []cli.Command{
+				{
+					Name:    "export",
+					Usage:   "Export permanent Jenkins agents",
+					Aliases: []string{"e"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "directory, d",
+							Usage: "Directory of the nodes",
+							Value: "nodes",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ExportNodes(server, username, password, c.String("directory"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "import",
+					Usage:   "Import (create or update) permanent Jenkins agents",
+					Aliases: []string{"i"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "directory, d",
+							Usage: "Directory of the nodes",
+							Value: "nodes",
+						},
+						cli.StringSliceFlag{
+							Name:  "rewrite",
+							Usage: "Replace a value in the launcher of the nodes (from=to), e.g. a host, may be repeated",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						rewrites, err := ParseNodeRewrites(c.StringSlice("rewrite"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						err = ImportNodes(server, username, password, c.String("directory"), rewrites)
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "list",
+					Usage:   "List Jenkins nodes with their state",
+					Aliases: []string{"l"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json)",
+							Value: "table",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ListNodes(server, username, password, c.String("format"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "offline",
+					Usage:     "Take Jenkins nodes temporarily offline, running builds continue",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "message, m",
+							Usage: "Reason the nodes are offline",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" || c.NArg() == 0 {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						for _, name := range c.Args() {
+							err := SetNodeOffline(server, name, username, password, true, c.String("message"))
+							if err != nil {
+								return cli.NewExitError(err.Error(), 1)
+							}
+							fmt.Printf("Node %s is offline\n", name)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "online",
+					Usage:     "Bring temporarily offline Jenkins nodes back online",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" || c.NArg() == 0 {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						for _, name := range c.Args() {
+							err := SetNodeOffline(server, name, username, password, false, "")
+							if err != nil {
+								return cli.NewExitError(err.Error(), 1)
+							}
+							fmt.Printf("Node %s is online\n", name)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "drain",
+					Usage:     "Take Jenkins nodes offline and wait until their builds are done",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "message, m",
+							Usage: "Reason the nodes are offline",
+							Value: "Drained by butler",
+						},
+						cli.DurationFlag{
+							Name:  "timeout",
+							Usage: "Maximum time to wait for the builds of the nodes, 0 to wait forever",
+							Value: time.Hour,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" || c.NArg() == 0 {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := DrainNodes(server, c.Args(), username, password, c.String("message"), c.Duration("timeout"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "casc",
+			Usage: "Jenkins Configuration as Code Management",
+			Subcommands: []cli.Command{
+				{
+					Name:    "export",
+					Usage:   "Export the Configuration as Code YAML",
+					Aliases: []string{"e"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "File to write the configuration to instead of STDOUT",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+
+						if server == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ExportCasc(server, username, password, c.String("output"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "apply",
+					Usage:   "Validate and apply a Configuration as Code YAML file",
+					Aliases: []string{"a"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Configuration as Code YAML file",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Only validate the configuration",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var file = c.String("file")
+
+						if server == "" || file == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						err := ApplyCasc(server, username, password, file, c.Bool("dry-run"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "backup",
+			Usage: "Backup jobs, plugins, credentials, views, nodes and configuration as code",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "server, s",
+					Usage:  "Jenkins server",
+					EnvVar: "JENKINS_SERVER",
+				},
+				cli.StringFlag{
+					Name:   "username, u",
+					Usage:  "Jenkins username",
+					EnvVar: "JENKINS_USER",
+				},
+				cli.StringFlag{
+					Name:   "password, p",
+					Usage:  "Jenkins password",
+					EnvVar: "JENKINS_PASSWORD",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "Directory to create the timestamped backup in",
+					Value: ".",
+				},
+				cli.StringSliceFlag{
+					Name:  "encrypt-to",
+					Usage: "Encrypt credentials for age recipient (age1...), may be repeated",
+				},
+				cli.StringFlag{
+					Name:   "passphrase",
+					Usage:  "Encrypt credentials with passphrase",
+					EnvVar: "BUTLER_PASSPHRASE",
+				},
+				cli.BoolFlag{
+					Name:  "skip-credentials",
+					Usage: "Do not backup credentials",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var server = getSanitizedUrl(c.String("server"))
+				var username = c.String("username")
+				var password = c.String("password")
+
+				if server == "" {
+					cli.ShowCommandHelp(c, "backup")
+					return nil
+				}
+
+				options := BackupOptions{
+					Recipients:      c.StringSlice("encrypt-to"),
+					Passphrase:      c.String("passphrase"),
+					SkipCredentials: c.Bool("skip-credentials"),
+				}
+				directory, err := Backup(server, username, password, c.String("output"), options)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				fmt.Printf("Backup written to %s\n", directory)
+				return nil
+			},
+		},
+		{
+			Name:      "restore",
+			Usage:     "Restore a backup",
+			ArgsUsage: "<backup directory>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "server, s",
+					Usage:  "Jenkins server",
+					EnvVar: "JENKINS_SERVER",
+				},
+				cli.StringFlag{
+					Name:   "username, u",
+					Usage:  "Jenkins username",
+					EnvVar: "JENKINS_USER",
+				},
+				cli.StringFlag{
+					Name:   "password, p",
+					Usage:  "Jenkins password",
+					EnvVar: "JENKINS_PASSWORD",
+				},
+				cli.StringSliceFlag{
+					Name:  "identity",
+					Usage: "age identity file to decrypt encrypted credentials, may be repeated",
+				},
+				cli.StringFlag{
+					Name:   "passphrase",
+					Usage:  "Passphrase to decrypt encrypted credentials",
+					EnvVar: "BUTLER_PASSPHRASE",
+				},
+				cli.BoolFlag{
+					Name:  "skip-plugins",
+					Usage: "Do not install plugins",
+				},
+				cli.BoolFlag{
+					Name:  "skip-credentials",
+					Usage: "Do not restore credentials",
+				},
+				cli.BoolFlag{
+					Name:  "casc",
+					Usage: "Apply the configuration as code of the backup",
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "Maximum time to wait for the plugins to be installed and for the restart, 0 to wait forever",
+					Value: 30 * time.Minute,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var server = getSanitizedUrl(c.String("server"))
+				var username = c.String("username")
+				var password = c.String("password")
+
+				if server == "" || c.NArg() != 1 {
+					cli.ShowCommandHelp(c, "restore")
+					return nil
+				}
+
+				options := RestoreOptions{
+					IdentityFiles:   c.StringSlice("identity"),
+					Passphrase:      c.String("passphrase"),
+					SkipPlugins:     c.Bool("skip-plugins"),
+					SkipCredentials: c.Bool("skip-credentials"),
+					ApplyCasc:       c.Bool("casc"),
+					Timeout:         c.Duration("timeout"),
+				}
+				err := Restore(server, username, password, c.Args().First(), options)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "script",
+			Usage: "Jenkins Script Console",
+			Subcommands: []cli.Command{
+				{
+					Name:    "run",
+					Usage:   "Run Groovy script on Jenkins",
+					Aliases: []string{"r"},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   "server, s",
+							Usage:  "Jenkins server",
+							EnvVar: "JENKINS_SERVER",
+						},
+						cli.StringFlag{
+							Name:   "username, u",
+							Usage:  "Jenkins username",
+							EnvVar: "JENKINS_USER",
+						},
+						cli.StringFlag{
+							Name:   "password, p",
+							Usage:  "Jenkins password",
+							EnvVar: "JENKINS_PASSWORD",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Groovy script",
+						},
+						cli.StringSliceFlag{
+							Name:  "arg, a",
+							Usage: "Script argument (key=value), available as args.key, may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "output-dir, o",
+							Usage: "Save output to a file named after the server in directory instead of printing it",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var server = getSanitizedUrl(c.String("server"))
+						var username = c.String("username")
+						var password = c.String("password")
+						var file = c.String("file")
+
+						if server == "" || file == "" {
+							cli.ShowSubcommandHelp(c)
+							return nil
+						}
+
+						arguments, err := ParseScriptArguments(c.StringSlice("arg"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						err = RunScript(server, username, password, file, arguments, c.String("output-dir"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+	}
+	app.CommandNotFound = func(c *cli.Context, command string) {
+		fmt.Fprintf(c.App.Writer, "Command not found %q !", command)
+	}
+	app.Run(os.Args)
+}
+
+func getImportOptions(c *cli.Context) (ImportOptions, error) {
+	var options ImportOptions
+
+	mapping, err := ParseCredentialsMapping(c.StringSlice("map"), c.String("map-file"))
+	if err != nil {
+		return options, err
+	}
+	options.CredentialsMapping = mapping
+
+	if c.String("values") != "" {
+		options.Values, err = LoadTemplateValues(c.String("values"))
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, nil
 }
 
 func getSanitizedUrl(url string) string {
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// permanentAgentComputer is the computer class of permanent agents, the only
+// nodes that are exported. The built-in node and cloud agents are skipped.
+const permanentAgentComputer = "hudson.slaves.SlaveComputer"
+
+type Computer struct {
+	Class              string `json:"_class"`
+	DisplayName        string `json:"displayName"`
+	Offline            bool   `json:"offline"`
+	TemporarilyOffline bool   `json:"temporarilyOffline"`
+	OfflineCauseReason string `json:"offlineCauseReason"`
+	Idle               bool   `json:"idle"`
+	NumExecutors       int    `json:"numExecutors"`
+	AssignedLabels     []struct {
+		Name string `json:"name"`
+	} `json:"assignedLabels"`
+	Executors []struct {
+		Idle bool `json:"idle"`
+	} `json:"executors"`
+}
+
+// NodeInfo is the state of a node as listed by ListNodes.
+type NodeInfo struct {
+	Name          string   `json:"name"`
+	Online        bool     `json:"online"`
+	OfflineReason string   `json:"offlineReason,omitempty"`
+	Executors     int      `json:"executors"`
+	Busy          int      `json:"busy"`
+	Idle          bool     `json:"idle"`
+	Labels        []string `json:"labels"`
+}
+
+// computerTree selects the fields of Computer in the remote API.
+const computerTree = "displayName,offline,temporarilyOffline,offlineCauseReason,idle,numExecutors,assignedLabels[name],executors[idle]"
+
+func (computer *Computer) GetInfo() NodeInfo {
+	info := NodeInfo{
+		Name:          computer.DisplayName,
+		Online:        !computer.Offline,
+		OfflineReason: computer.OfflineCauseReason,
+		Executors:     computer.NumExecutors,
+		Idle:          computer.Idle,
+		Labels:        make([]string, 0, len(computer.AssignedLabels)),
+	}
+	for _, executor := range computer.Executors {
+		if !executor.Idle {
+			info.Busy++
+		}
+	}
+	// every node has a label of its own name
+	for _, label := range computer.AssignedLabels {
+		if label.Name != computer.DisplayName {
+			info.Labels = append(info.Labels, label.Name)
+		}
+	}
+	return info
+}
+
+type ComputerList struct {
+	Computers []Computer `json:"computer"`
+}
+
+// builtInNodeNames maps the names of the built-in node to its name in urls.
+// Its display name is "Built-In Node", or "master" before Jenkins 2.307.
+var builtInNodeNames = map[string]string{
+	"Built-In Node": "(built-in)",
+	"built-in":      "(built-in)",
+	"(built-in)":    "(built-in)",
+	"master":        "(master)",
+	"(master)":      "(master)",
+}
+
+func GetNodeURL(server string, name string) string {
+	if urlName, ok := builtInNodeNames[name]; ok {
+		return fmt.Sprintf("%s/computer/%s", server, urlName)
+	}
+	return fmt.Sprintf("%s/computer/%s", server, neturl.PathEscape(name))
+}
+
+func GetComputers(server string, username string, password string) ([]Computer, error) {
+	url := fmt.Sprintf("%s/computer/api/json?tree=computer[%s]", server, computerTree)
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return []Computer{}, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return []Computer{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return []Computer{}, errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return []Computer{}, fmt.Errorf("Nodes cannot be read: %s", resp.Status)
+	}
+
+	var list ComputerList
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		return []Computer{}, err
+	}
+	return list.Computers, nil
+}
+
+// ExportNodes writes the config.xml of every permanent agent to
+// <directory>/<node>/config.xml.
+func ExportNodes(server string, username string, password string, directory string) error {
+	computers, err := GetComputers(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	for _, computer := range computers {
+		if computer.Class != permanentAgentComputer {
+			continue
+		}
+		fmt.Printf("Exporting node: %s\n", computer.DisplayName)
+		config, err := getConfigXML(GetNodeURL(server, computer.DisplayName), username, password)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Join(directory, computer.DisplayName), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(directory, computer.DisplayName, "config.xml"), config, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createNode creates a placeholder permanent agent, Jenkins can't create a
+// node from a config.xml directly.
+func createNode(server string, name string, username string, password string) error {
+	form, err := json.Marshal(map[string]interface{}{
+		"name":              name,
+		"nodeDescription":   "",
+		"numExecutors":      "1",
+		"remoteFS":          "/tmp",
+		"labelString":       "",
+		"mode":              "NORMAL",
+		"type":              "hudson.slaves.DumbSlave",
+		"retentionStrategy": map[string]string{"stapler-class": "hudson.slaves.RetentionStrategy$Always"},
+		"nodeProperties":    map[string]string{"stapler-class-bag": "true"},
+		"launcher":          map[string]string{"stapler-class": "hudson.slaves.JNLPLauncher"},
+	})
+	if err != nil {
+		return err
+	}
+
+	data := neturl.Values{}
+	data.Set("name", name)
+	data.Set("type", "hudson.slaves.DumbSlave")
+	data.Set("json", string(form))
+
+	// a created node redirects to the node list
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest("POST", server+"/computer/doCreateItem", strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 && resp.StatusCode != 302 {
+		return fmt.Errorf("Node %s couldn't be created: %s", name, resp.Status)
+	}
+
+	return nil
+}
+
+// ImportNode creates a node, or updates it if it exists, from its config.xml.
+func ImportNode(server string, name string, username string, password string, config []byte) error {
+	nodeURL := GetNodeURL(server, name)
+	exists, err := itemExists(nodeURL, username, password)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = createNode(server, name, username, password)
+		if err != nil {
+			return err
+		}
+	}
+	return postConfigXML(server, nodeURL+"/config.xml", username, password, config)
+}
+
+var launcherPattern = regexp.MustCompile(`(?s)<launcher\b.*?</launcher>`)
+
+// ParseNodeRewrites parses from=to pairs into the old, new pairs of
+// strings.NewReplacer.
+func ParseNodeRewrites(pairs []string) ([]string, error) {
+	rewrites := make([]string, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return rewrites, fmt.Errorf("Invalid rewrite %q, expected from=to", pair)
+		}
+		rewrites = append(rewrites, escapeXMLString(parts[0]), escapeXMLString(parts[1]))
+	}
+	return rewrites, nil
+}
+
+func escapeXMLString(value string) string {
+	var out bytes.Buffer
+	escapeXML(&out, value, false)
+	return out.String()
+}
+
+// RewriteNodeLauncher replaces values in the <launcher> of a node config, like
+// the host and credentials an agent is connected with.
+func RewriteNodeLauncher(config []byte, rewrites []string) []byte {
+	if len(rewrites) == 0 {
+		return config
+	}
+	replacer := strings.NewReplacer(rewrites...)
+	return launcherPattern.ReplaceAllFunc(config, func(launcher []byte) []byte {
+		return []byte(replacer.Replace(string(launcher)))
+	})
+}
+
+// ImportNodes imports the nodes exported to directory by ExportNodes, with
+// the rewrites of ParseNodeRewrites applied to their launchers.
+func ImportNodes(server string, username string, password string, directory string, rewrites []string) error {
+	nodes, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	failed := make([]string, 0)
+	for _, node := range nodes {
+		if !node.IsDir() {
+			continue
+		}
+		fmt.Printf("Import node: %s\n", node.Name())
+		config, err := ioutil.ReadFile(filepath.Join(directory, node.Name(), "config.xml"))
+		if err != nil {
+			return err
+		}
+		err = ImportNode(server, node.Name(), username, password, RewriteNodeLauncher(config, rewrites))
+		if err != nil {
+			fmt.Printf("%s: %v\n", node.Name(), err)
+			failed = append(failed, node.Name())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Nodes couldn't be imported: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func GetComputer(server string, name string, username string, password string) (Computer, error) {
+	url := fmt.Sprintf("%s/api/json?tree=%s", GetNodeURL(server, name), computerTree)
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Computer{}, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Computer{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return Computer{}, errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode == 404 {
+		return Computer{}, fmt.Errorf("Node %s not found", name)
+	}
+
+	if resp.StatusCode != 200 {
+		return Computer{}, fmt.Errorf("Node %s cannot be read: %s", name, resp.Status)
+	}
+
+	var computer Computer
+	err = json.NewDecoder(resp.Body).Decode(&computer)
+	return computer, err
+}
+
+func ListNodes(server string, username string, password string, format string) error {
+	computers, err := GetComputers(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	infos := make([]NodeInfo, 0, len(computers))
+	for _, computer := range computers {
+		infos = append(infos, computer.GetInfo())
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "table", "":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "State", "Executors", "Busy", "Idle", "Labels"})
+		for _, info := range infos {
+			state := "online"
+			if !info.Online {
+				state = "offline"
+				if info.OfflineReason != "" {
+					state += ": " + info.OfflineReason
+				}
+			}
+			table.Append([]string{info.Name, state, fmt.Sprintf("%d", info.Executors), fmt.Sprintf("%d", info.Busy), fmt.Sprintf("%t", info.Idle), strings.Join(info.Labels, " ")})
+		}
+		table.Render()
+	default:
+		return fmt.Errorf("Unknown format %q, expected table or json", format)
+	}
+	return nil
+}
+
+func postNodeAction(server string, name string, username string, password string, action string, values neturl.Values) error {
+	url := fmt.Sprintf("%s/%s", GetNodeURL(server, name), action)
+
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Node %s cannot be changed: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// SetNodeOffline takes a node temporarily offline with a message, or brings it
+// back online. Running builds are not interrupted.
+func SetNodeOffline(server string, name string, username string, password string, offline bool, message string) error {
+	computer, err := GetComputer(server, name, username, password)
+	if err != nil {
+		return err
+	}
+
+	if computer.TemporarilyOffline == offline {
+		if offline && message != "" {
+			return postNodeAction(server, name, username, password, "changeOfflineCause", neturl.Values{"offlineMessage": {message}})
+		}
+		return nil
+	}
+
+	return postNodeAction(server, name, username, password, "toggleOffline", neturl.Values{"offlineMessage": {message}})
+}
+
+// nodePollInterval is how often DrainNode checks whether a node is idle.
+var nodePollInterval = 5 * time.Second
+
+// DrainNodes takes nodes offline, so they get no new builds, and waits until
+// their running builds are done.
+func DrainNodes(server string, names []string, username string, password string, message string, timeout time.Duration) error {
+	for _, name := range names {
+		err := SetNodeOffline(server, name, username, password, true, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	for _, name := range names {
+		for {
+			computer, err := GetComputer(server, name, username, password)
+			if err != nil {
+				return err
+			}
+
+			info := computer.GetInfo()
+			if computer.Idle {
+				fmt.Printf("Node %s is drained after %s\n", name, time.Since(start).Round(time.Second))
+				break
+			}
+			if timeout > 0 && time.Since(start) >= timeout {
+				return fmt.Errorf("Node %s is offline but still busy with %d builds after %s", name, info.Busy, timeout)
+			}
+
+			fmt.Printf("Node %s is busy with %d builds\n", name, info.Busy)
+			time.Sleep(nodePollInterval)
+		}
+	}
+	return nil
+}
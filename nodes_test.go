@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sshNodeConfig = `<?xml version='1.1' encoding='UTF-8'?>
+<slave>
+  <name>agent-dev.example.com</name>
+  <description>agent-dev.example.com</description>
+  <remoteFS>/home/jenkins</remoteFS>
+  <launcher class="hudson.plugins.sshslaves.SSHLauncher" plugin="ssh-slaves@2.916">
+    <host>agent-dev.example.com</host>
+    <port>22</port>
+    <credentialsId>ssh-dev</credentialsId>
+  </launcher>
+</slave>`
+
+func TestRewriteNodeLauncher(t *testing.T) {
+	assert := assert.New(t)
+
+	rewrites, err := ParseNodeRewrites([]string{"agent-dev.example.com=agent-prod.example.com", "ssh-dev=ssh-prod"})
+	assert.Nil(err)
+	got := string(RewriteNodeLauncher([]byte(sshNodeConfig), rewrites))
+
+	assert.Contains(got, "<name>agent-dev.example.com</name>")
+	assert.Contains(got, "<description>agent-dev.example.com</description>")
+	assert.Contains(got, "<host>agent-prod.example.com</host>")
+	assert.Contains(got, "<credentialsId>ssh-prod</credentialsId>")
+
+	assert.Equal(sshNodeConfig, string(RewriteNodeLauncher([]byte(sshNodeConfig), nil)))
+
+	_, err = ParseNodeRewrites([]string{"novalue"})
+	assert.NotNil(err)
+}
+
+func TestExportNodes(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-nodes")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computer/api/json":
+			w.Write([]byte(`{"computer":[{"_class":"hudson.model.Hudson$MasterComputer","displayName":"Built-In Node"},{"_class":"hudson.slaves.SlaveComputer","displayName":"agent1"},{"_class":"org.csanchez.jenkins.plugins.kubernetes.KubernetesComputer","displayName":"pod-1"}]}`))
+		case "/computer/agent1/config.xml":
+			w.Write([]byte(sshNodeConfig))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	err = ExportNodes(server.URL, "user", "password", directory)
+
+	assert.Nil(err)
+	files, _ := ioutil.ReadDir(directory)
+	assert.Len(files, 1)
+	config, err := ioutil.ReadFile(directory + "/agent1/config.xml")
+	assert.Nil(err)
+	assert.Equal(sshNodeConfig, string(config))
+}
+
+func TestImportNode(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		want   []string
+	}{
+		{"create", false, []string{"/computer/doCreateItem", "/computer/agent1/config.xml"}},
+		{"update", true, []string{"/computer/agent1/config.xml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/crumbIssuer/api/xml":
+					w.Write([]byte("Jenkins-Crumb:abc"))
+				case r.Method == "GET" && r.URL.Path == "/computer/agent1/api/json" && tt.exists:
+					w.Write([]byte(`{}`))
+				case r.Method == "GET":
+					w.WriteHeader(404)
+				case r.URL.Path == "/computer/doCreateItem":
+					assert.Equal(t, "agent1", r.FormValue("name"))
+					assert.Equal(t, "hudson.slaves.DumbSlave", r.FormValue("type"))
+					posted = append(posted, r.URL.Path)
+					http.Redirect(w, r, "/computer/", http.StatusFound)
+				default:
+					posted = append(posted, r.URL.Path)
+				}
+			}))
+			defer server.Close()
+
+			err := ImportNode(server.URL, "agent1", "user", "password", []byte(sshNodeConfig))
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, posted)
+		})
+	}
+}
+
+func TestComputer_GetInfo(t *testing.T) {
+	var computer Computer
+	err := json.Unmarshal([]byte(`{"displayName":"agent1","offline":true,"temporarilyOffline":true,"offlineCauseReason":"patching","idle":false,"numExecutors":2,"assignedLabels":[{"name":"agent1"},{"name":"linux"},{"name":"docker"}],"executors":[{"idle":false},{"idle":true}]}`), &computer)
+	assert.Nil(t, err)
+
+	assert.Equal(t, NodeInfo{
+		Name:          "agent1",
+		Online:        false,
+		OfflineReason: "patching",
+		Executors:     2,
+		Busy:          1,
+		Idle:          false,
+		Labels:        []string{"linux", "docker"},
+	}, computer.GetInfo())
+}
+
+func TestGetNodeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"agent1", "http://jenkins/computer/agent1"},
+		{"agent 1", "http://jenkins/computer/agent%201"},
+		{"Built-In Node", "http://jenkins/computer/(built-in)"},
+		{"built-in", "http://jenkins/computer/(built-in)"},
+		{"master", "http://jenkins/computer/(master)"},
+	}
+	for _, tt := range tests {
+		if got := GetNodeURL("http://jenkins", tt.name); got != tt.want {
+			t.Errorf("GetNodeURL(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetNodeOffline_BuiltInNode(t *testing.T) {
+	server := newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/computer/(built-in)/api/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"_class":"hudson.model.Hudson$MasterComputer","displayName":"Built-In Node","temporarilyOffline":false}`))
+		},
+		"/computer/(built-in)/toggleOffline": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	defer server.Close()
+
+	err := SetNodeOffline(server.URL, "Built-In Node", "user", "password", true, "patching")
+
+	assert.Nil(t, err)
+	assert.Len(t, server.Requests("/computer/(built-in)/toggleOffline"), 1)
+}
+
+// newNodeServer serves agent1, which is busy for the given number of polls.
+func newNodeServer(temporarilyOffline bool, busyPolls int) *testJenkinsServer {
+	return newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/computer/agent1/api/json": func(w http.ResponseWriter, r *http.Request) {
+			idle := busyPolls <= 0
+			busyPolls--
+			fmt.Fprintf(w, `{"displayName":"agent1","temporarilyOffline":%t,"idle":%t,"executors":[{"idle":%t}]}`, temporarilyOffline, idle, idle)
+		},
+		"/computer/agent1/toggleOffline": func(w http.ResponseWriter, r *http.Request) {
+			temporarilyOffline = !temporarilyOffline
+		},
+		"/computer/agent1/changeOfflineCause": func(w http.ResponseWriter, r *http.Request) {},
+	})
+}
+
+// nodeActions returns the offline actions taken on agent1 with their message.
+func nodeActions(server *testJenkinsServer) []string {
+	var actions []string
+	for _, request := range server.Requests("/computer/agent1/toggleOffline", "/computer/agent1/changeOfflineCause") {
+		actions = append(actions, request.Path+" "+request.Form.Get("offlineMessage"))
+	}
+	return actions
+}
+
+func TestSetNodeOffline(t *testing.T) {
+	tests := []struct {
+		name               string
+		temporarilyOffline bool
+		offline            bool
+		message            string
+		want               []string
+	}{
+		{"offline", false, true, "patching", []string{"/computer/agent1/toggleOffline patching"}},
+		{"already offline", true, true, "patching", []string{"/computer/agent1/changeOfflineCause patching"}},
+		{"online", true, false, "", []string{"/computer/agent1/toggleOffline "}},
+		{"already online", false, false, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newNodeServer(tt.temporarilyOffline, 0)
+			defer server.Close()
+
+			err := SetNodeOffline(server.URL, "agent1", "user", "password", tt.offline, tt.message)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, nodeActions(server))
+		})
+	}
+}
+
+func TestDrainNodes(t *testing.T) {
+	nodePollInterval = time.Millisecond
+	defer func() { nodePollInterval = 5 * time.Second }()
+
+	server := newNodeServer(false, 3)
+	defer server.Close()
+
+	err := DrainNodes(server.URL, []string{"agent1"}, "user", "password", "patching", time.Minute)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/computer/agent1/toggleOffline patching"}, nodeActions(server))
+
+	server = newNodeServer(true, 1000)
+	defer server.Close()
+
+	err = DrainNodes(server.URL, []string{"agent1"}, "user", "password", "patching", 10*time.Millisecond)
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const normalizedXMLDeclaration = "<?xml version='1.1' encoding='UTF-8'?>"
+
+var xmlDeclarationPattern = regexp.MustCompile(`^\s*<\?xml[^?]*\?>`)
+
+// xmlNode is an element, text, comment, processing instruction or directive
+// of a parsed config.
+type xmlNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Children []*xmlNode
+	Text     string
+	Raw      string
+}
+
+func (node *xmlNode) isElement() bool {
+	return node.Name.Local != ""
+}
+
+func (node *xmlNode) hasText() bool {
+	for _, child := range node.Children {
+		if !child.isElement() && child.Raw == "" && strings.TrimSpace(child.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseXMLNodes(data []byte) ([]*xmlNode, error) {
+	// the decoder only supports xml 1.0 declarations, Jenkins writes 1.1
+	data = xmlDeclarationPattern.ReplaceAll(data, []byte{})
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch token := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: token.Name, Attrs: append([]xml.Attr{}, token.Attr...)}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("Unexpected end element %s", token.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.Children = append(parent.Children, &xmlNode{Text: string(token)})
+		case xml.Comment:
+			parent.Children = append(parent.Children, &xmlNode{Raw: "<!--" + string(token) + "-->"})
+		case xml.ProcInst:
+			parent.Children = append(parent.Children, &xmlNode{Raw: "<?" + token.Target + " " + string(token.Inst) + "?>"})
+		case xml.Directive:
+			parent.Children = append(parent.Children, &xmlNode{Raw: "<!" + string(token) + ">"})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("Element %s is not closed", stack[len(stack)-1].Name.Local)
+	}
+	return root.Children, nil
+}
+
+func xmlNodeName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// escapeXML escapes like Jenkins does, characters that are not allowed
+// literally are written as character references.
+func escapeXML(out *bytes.Buffer, value string, attribute bool) {
+	for _, r := range value {
+		switch {
+		case r == '&':
+			out.WriteString("&amp;")
+		case r == '<':
+			out.WriteString("&lt;")
+		case r == '>':
+			out.WriteString("&gt;")
+		case r == '"':
+			out.WriteString("&quot;")
+		case r == '\'':
+			out.WriteString("&apos;")
+		case r == '\r':
+			out.WriteString("&#xd;")
+		case attribute && (r == '\n' || r == '\t'):
+			fmt.Fprintf(out, "&#x%x;", r)
+		case r < 0x20 && r != '\n' && r != '\t', r == 0xFFFE, r == 0xFFFF:
+			fmt.Fprintf(out, "&#x%x;", r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+}
+
+func writeXMLNode(out *bytes.Buffer, node *xmlNode, depth int, indent bool, stripPluginVersions bool) {
+	if !node.isElement() {
+		if node.Raw != "" {
+			out.WriteString(node.Raw)
+		} else {
+			escapeXML(out, node.Text, false)
+		}
+		return
+	}
+
+	attrs := append([]xml.Attr{}, node.Attrs...)
+	sort.SliceStable(attrs, func(i, j int) bool { return xmlNodeName(attrs[i].Name) < xmlNodeName(attrs[j].Name) })
+
+	out.WriteString("<" + xmlNodeName(node.Name))
+	for _, attr := range attrs {
+		value := attr.Value
+		if stripPluginVersions && xmlNodeName(attr.Name) == "plugin" {
+			value = strings.SplitN(value, "@", 2)[0]
+		}
+		out.WriteString(" " + xmlNodeName(attr.Name) + "=\"")
+		escapeXML(out, value, true)
+		out.WriteString("\"")
+	}
+
+	if len(node.Children) == 0 {
+		out.WriteString("/>")
+		return
+	}
+	out.WriteString(">")
+
+	// text content is kept verbatim, only element-only content is indented
+	if !indent || node.hasText() || !hasElementChildren(node) {
+		for _, child := range node.Children {
+			writeXMLNode(out, child, depth+1, false, stripPluginVersions)
+		}
+	} else {
+		for _, child := range node.Children {
+			if !child.isElement() && child.Raw == "" {
+				continue
+			}
+			out.WriteString("\n" + strings.Repeat("  ", depth+1))
+			writeXMLNode(out, child, depth+1, true, stripPluginVersions)
+		}
+		out.WriteString("\n" + strings.Repeat("  ", depth))
+	}
+	out.WriteString("</" + xmlNodeName(node.Name) + ">")
+}
+
+func hasElementChildren(node *xmlNode) bool {
+	for _, child := range node.Children {
+		if child.isElement() || child.Raw != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeJobConfig canonicalizes a config.xml so exports of an unchanged
+// job are identical: the xml declaration, indentation and attribute order are
+// always the same. It ends with a newline only if the input does, so a
+// config.xml written by Jenkins stays byte-identical. With stripPluginVersions
+// the version is removed from plugin="name@version" attributes, which Jenkins
+// ignores on import.
+func NormalizeJobConfig(data []byte, stripPluginVersions bool) ([]byte, error) {
+	nodes, err := parseXMLNodes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(normalizedXMLDeclaration)
+	for _, node := range nodes {
+		if !node.isElement() && node.Raw == "" {
+			continue
+		}
+		out.WriteString("\n")
+		writeXMLNode(&out, node, 0, true, stripPluginVersions)
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		out.WriteString("\n")
+	}
+	return out.Bytes(), nil
+}
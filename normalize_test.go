@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const unnormalizedJobConfig = "<?xml version='1.1' encoding='UTF-8'?>\n" +
+	"<flow-definition plugin=\"workflow-job@1289.vd1c337fd5354\">\n" +
+	"    <description>Build &amp; deploy</description>\n" +
+	"  <keepDependencies>false</keepDependencies>\n" +
+	"  <properties></properties>\n" +
+	"  <definition plugin=\"workflow-cps@3691.v28b_14c465a_b_b_\" class=\"org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition\">\n" +
+	"    <script>pipeline {&#xd;\n    agent any&#xd;\n    stages { stage(&apos;Build&apos;) { steps { sh &quot;make&quot; } } }&#xd;\n}</script>\n" +
+	"    <sandbox>true</sandbox>\n" +
+	"  </definition>\n" +
+	"  <!-- generated -->\n" +
+	"  <disabled>false</disabled>\n" +
+	"</flow-definition>"
+
+func TestNormalizeJobConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	got, err := NormalizeJobConfig([]byte(unnormalizedJobConfig), false)
+
+	assert.Nil(err)
+	assert.Equal("<?xml version='1.1' encoding='UTF-8'?>\n"+
+		"<flow-definition plugin=\"workflow-job@1289.vd1c337fd5354\">\n"+
+		"  <description>Build &amp; deploy</description>\n"+
+		"  <keepDependencies>false</keepDependencies>\n"+
+		"  <properties/>\n"+
+		"  <definition class=\"org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition\" plugin=\"workflow-cps@3691.v28b_14c465a_b_b_\">\n"+
+		"    <script>pipeline {&#xd;\n    agent any&#xd;\n    stages { stage(&apos;Build&apos;) { steps { sh &quot;make&quot; } } }&#xd;\n}</script>\n"+
+		"    <sandbox>true</sandbox>\n"+
+		"  </definition>\n"+
+		"  <!-- generated -->\n"+
+		"  <disabled>false</disabled>\n"+
+		"</flow-definition>", string(got))
+
+	again, err := NormalizeJobConfig(got, false)
+	assert.Nil(err)
+	assert.Equal(string(got), string(again))
+}
+
+func TestNormalizeJobConfig_StripPluginVersions(t *testing.T) {
+	got, err := NormalizeJobConfig([]byte(unnormalizedJobConfig), true)
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(got), "<flow-definition plugin=\"workflow-job\">")
+	assert.Contains(t, string(got), "<definition class=\"org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition\" plugin=\"workflow-cps\">")
+}
+
+func TestNormalizeJobConfig_KeepsMixedContent(t *testing.T) {
+	got, err := NormalizeJobConfig([]byte("<?xml version='1.0' encoding='UTF-8'?><project><description>  a <b>b</b>\n c</description><empty>  </empty></project>"), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "<?xml version='1.1' encoding='UTF-8'?>\n<project>\n  <description>  a <b>b</b>\n c</description>\n  <empty>  </empty>\n</project>", string(got))
+}
+
+func TestNormalizeJobConfig_Invalid(t *testing.T) {
+	_, err := NormalizeJobConfig([]byte("<project><description></project>"), false)
+
+	assert.NotNil(t, err)
+}
+
+func TestNormalizeJobConfig_JenkinsWritten(t *testing.T) {
+	config := "<?xml version='1.1' encoding='UTF-8'?>\n" +
+		"<flow-definition plugin=\"workflow-job@1289.vd1c337fd5354\">\n" +
+		"  <actions/>\n" +
+		"  <description>Build &amp; deploy</description>\n" +
+		"  <keepDependencies>false</keepDependencies>\n" +
+		"  <properties/>\n" +
+		"  <definition class=\"org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition\" plugin=\"workflow-cps@3691.v28b_14c465a_b_b_\">\n" +
+		"    <script>pipeline {&#xd;\n    agent any&#xd;\n    stages { stage(&apos;Build&apos;) { steps { sh &quot;make &lt; in&quot; } } }&#xd;\n}</script>\n" +
+		"    <sandbox>true</sandbox>\n" +
+		"  </definition>\n" +
+		"  <triggers/>\n" +
+		"  <disabled>false</disabled>\n" +
+		"</flow-definition>"
+
+	got, err := NormalizeJobConfig([]byte(config), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, config, string(got))
+}
@@ -6,16 +6,25 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
 )
 
 type Plugin struct {
-	Name        string `json:"shortName"`
-	Description string `json:"longName"`
-	Version     string `json:"version"`
+	Name         string             `json:"shortName"`
+	Description  string             `json:"longName"`
+	Version      string             `json:"version"`
+	Active       bool               `json:"active"`
+	Enabled      bool               `json:"enabled"`
+	Dependencies []PluginDependency `json:"dependencies"`
 }
 
 type PluginData struct {
@@ -23,6 +32,50 @@ type PluginData struct {
 	Plugins []Plugin `json:"plugins"`
 }
 
+type PluginWarning struct {
+	Plugin   string   `json:"plugin"`
+	GroupID  string   `json:"groupId"`
+	Version  string   `json:"version"`
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	URL      string   `json:"url"`
+	Severity string   `json:"severity"`
+	Affected []string `json:"affected"`
+	Fixed    string   `json:"fixed"`
+}
+
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+// severityRank orders severities from low to critical. Warnings without
+// (known) severity information rank as critical, so gating stays on the safe side.
+func severityRank(severity string) int {
+	for i, level := range severityLevels {
+		if strings.EqualFold(level, severity) {
+			return i
+		}
+	}
+	return len(severityLevels) - 1
+}
+
+func countWarningsAtOrAbove(warnings []PluginWarning, severity string) int {
+	count := 0
+	for _, warning := range warnings {
+		if severityRank(warning.Severity) >= severityRank(severity) {
+			count++
+		}
+	}
+	return count
+}
+
+func isValidSeverity(severity string) bool {
+	for _, level := range severityLevels {
+		if strings.EqualFold(level, severity) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetPlugins(server string, username string, password string) ([]Plugin, error) {
 	url := fmt.Sprintf("%s/pluginManager/api/json?depth=1", server)
 
@@ -58,24 +111,45 @@ func ExportPlugins(server string, username string, password string) error {
 		return err
 	}
 
-	file, err := os.Create("plugins.txt")
+	err = writePluginsFile("plugins.txt", plugins)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	for _, plugin := range plugins {
 		table.Append([]string{plugin.Name, plugin.Version, plugin.Description})
-		file.WriteString(fmt.Sprintf("%s@%s\n", plugin.Name, plugin.Version))
 	}
 
 	table.Render()
 	return nil
 }
 
+// writePluginsFile writes the plugins as name@version lines, the format read
+// by ImportPluginsFromFile.
+func writePluginsFile(path string, plugins []Plugin) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, plugin := range plugins {
+		_, err = fmt.Fprintf(file, "%s@%s\n", plugin.Name, plugin.Version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func ImportPlugins(server string, username string, password string) error {
+	return ImportPluginsFromFile(server, username, password, "plugins.txt")
+}
+
+// ImportPluginsFromFile installs the plugins of a plugins.txt file.
+func ImportPluginsFromFile(server string, username string, password string, path string) error {
 	url := fmt.Sprintf("%s/pluginManager/installNecessaryPlugins", server)
-	file, err := os.Open("plugins.txt")
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
@@ -119,3 +193,489 @@ func ImportPlugins(server string, username string, password string) error {
 	}
 	return nil
 }
+
+// UpdateCenter is the state of the plugin installations of Jenkins.
+type UpdateCenter struct {
+	Jobs []struct {
+		Name   string `json:"name"`
+		Status struct {
+			Type string `json:"type"`
+		} `json:"status"`
+	} `json:"jobs"`
+	RestartRequiredForCompletion bool `json:"restartRequiredForCompletion"`
+}
+
+// pluginPollInterval is how often the plugin installations and the restart
+// of Jenkins are checked.
+var pluginPollInterval = 5 * time.Second
+
+func GetUpdateCenter(server string, username string, password string) (UpdateCenter, error) {
+	var updateCenter UpdateCenter
+	err := getJSON(server+"/updateCenter/api/json?tree=restartRequiredForCompletion,jobs[name,status[type]]", username, password, &updateCenter)
+	return updateCenter, err
+}
+
+// WaitForPluginInstalls waits until Jenkins has installed the plugins, which
+// installNecessaryPlugins only queues. It returns whether Jenkins has to be
+// restarted for the plugins to be loaded.
+func WaitForPluginInstalls(server string, username string, password string, timeout time.Duration) (bool, error) {
+	start := time.Now()
+	for {
+		updateCenter, err := GetUpdateCenter(server, username, password)
+		if err != nil {
+			return false, err
+		}
+
+		running := 0
+		failed := make([]string, 0)
+		for _, job := range updateCenter.Jobs {
+			switch job.Status.Type {
+			case "Pending", "Installing":
+				running++
+			case "Failure":
+				failed = append(failed, job.Name)
+			}
+		}
+
+		if running == 0 {
+			if len(failed) > 0 {
+				return false, fmt.Errorf("Plugins couldn't be installed: %s", strings.Join(failed, ", "))
+			}
+			return updateCenter.RestartRequiredForCompletion, nil
+		}
+		if timeout > 0 && time.Since(start) >= timeout {
+			return false, fmt.Errorf("%d plugins are still being installed after %s", running, timeout)
+		}
+
+		fmt.Printf("Waiting for %d plugins to be installed\n", running)
+		time.Sleep(pluginPollInterval)
+	}
+}
+
+// SafeRestart restarts Jenkins once no builds are running and waits until it
+// is back up.
+func SafeRestart(server string, username string, password string, timeout time.Duration) error {
+	client := &http.Client{
+		// Jenkins redirects to the page saying it is restarting
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest("POST", server+"/safeRestart", nil)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 && resp.StatusCode != 302 {
+		return fmt.Errorf("Jenkins cannot be restarted: %s", resp.Status)
+	}
+
+	// Jenkins keeps answering until the running builds are done, so it is
+	// only back once it has been down
+	start := time.Now()
+	down := false
+	for {
+		up := isJenkinsUp(server, username, password)
+		if !up {
+			down = true
+		} else if down {
+			fmt.Printf("Jenkins is back after %s\n", time.Since(start).Round(time.Second))
+			return nil
+		}
+		if timeout > 0 && time.Since(start) >= timeout {
+			return fmt.Errorf("Jenkins is not back after %s", timeout)
+		}
+		time.Sleep(pluginPollInterval)
+	}
+}
+
+func isJenkinsUp(server string, username string, password string) bool {
+	var info struct{}
+	return getJSON(server+"/api/json?tree=mode", username, password, &info) == nil
+}
+
+func GetPluginWarnings(server string, username string, password string) ([]PluginWarning, error) {
+	var warnings []PluginWarning
+	err := ExecuteGroovyScriptForResult(pluginWarningsScript, server, username, password, &warnings)
+	if err != nil {
+		return []PluginWarning{}, fmt.Errorf("Security warnings cannot be read: %v", err)
+	}
+
+	return warnings, nil
+}
+
+// DefaultAdvisoryDatabase is the OSV API. The update center publishes no
+// severity for warnings, but the GitHub advisories of Jenkins plugins it
+// serves have one.
+const DefaultAdvisoryDatabase = "https://api.osv.dev"
+
+type osvAdvisory struct {
+	ID         string `json:"id"`
+	References []struct {
+		URL string `json:"url"`
+	} `json:"references"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// osvSeverities maps the severities of GitHub advisories to the audit levels.
+var osvSeverities = map[string]string{
+	"LOW":      "low",
+	"MODERATE": "medium",
+	"HIGH":     "high",
+	"CRITICAL": "critical",
+}
+
+// refersTo returns whether the advisory links the Jenkins security advisory
+// of a warning, e.g. https://www.jenkins.io/security/advisory/2022-05-17/#SECURITY-2617.
+func (advisory *osvAdvisory) refersTo(warningID string) bool {
+	for _, reference := range advisory.References {
+		if strings.HasSuffix(reference.URL, "#"+warningID) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAdvisories returns the advisories of the database affecting a plugin
+// version.
+func getAdvisories(database string, warning PluginWarning) ([]osvAdvisory, error) {
+	groupID := warning.GroupID
+	if groupID == "" {
+		groupID = "org.jenkins-ci.plugins"
+	}
+	query, err := json.Marshal(map[string]interface{}{
+		"version": warning.Version,
+		"package": map[string]string{"ecosystem": "Maven", "name": groupID + ":" + warning.Plugin},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(database+"/v1/query", "application/json", bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Advisories of %s cannot be read: %s", warning.Plugin, resp.Status)
+	}
+
+	var result struct {
+		Vulns []osvAdvisory `json:"vulns"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Vulns, err
+}
+
+// SetWarningSeverities takes the severity of every warning from the advisory
+// that refers to it. Warnings without such an advisory keep no severity.
+func SetWarningSeverities(warnings []PluginWarning, database string) error {
+	advisories := make(map[string][]osvAdvisory)
+	for i, warning := range warnings {
+		key := warning.Plugin + "@" + warning.Version
+		if _, ok := advisories[key]; !ok {
+			pluginAdvisories, err := getAdvisories(database, warning)
+			if err != nil {
+				return err
+			}
+			advisories[key] = pluginAdvisories
+		}
+		for _, advisory := range advisories[key] {
+			if advisory.refersTo(warning.ID) {
+				warnings[i].Severity = osvSeverities[strings.ToUpper(advisory.DatabaseSpecific.Severity)]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// AuditPlugins lists the active security warnings of the installed plugins
+// with their severity from the advisory database, if one is given. With
+// failOn, warnings at or above that severity are an error.
+func AuditPlugins(server string, username string, password string, failOn string, advisoryDatabase string) error {
+	if failOn != "" && !isValidSeverity(failOn) {
+		return fmt.Errorf("Unknown severity %q, expected one of %s", failOn, strings.Join(severityLevels, ", "))
+	}
+
+	plugins, err := GetPlugins(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := GetPluginWarnings(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	if advisoryDatabase != "" {
+		err = SetWarningSeverities(warnings, advisoryDatabase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Severities cannot be read, warnings count as critical: %v\n", err)
+		}
+	}
+
+	warningsByPlugin := make(map[string][]PluginWarning)
+	for _, warning := range warnings {
+		warningsByPlugin[warning.Plugin] = append(warningsByPlugin[warning.Plugin], warning)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Version", "Warning", "Severity", "Affected", "Fixed", "Advisory"})
+	for _, plugin := range plugins {
+		if len(warningsByPlugin[plugin.Name]) == 0 {
+			table.Append([]string{plugin.Name, plugin.Version, "", "", "", "", ""})
+			continue
+		}
+		for _, warning := range warningsByPlugin[plugin.Name] {
+			table.Append([]string{plugin.Name, plugin.Version, warning.ID, warning.Severity, strings.Join(warning.Affected, ", "), warning.Fixed, warning.URL})
+		}
+	}
+	table.Render()
+
+	if failOn == "" {
+		return nil
+	}
+
+	if count := countWarningsAtOrAbove(warnings, failOn); count > 0 {
+		return fmt.Errorf("%d security warning(s) at or above %s severity", count, failOn)
+	}
+	return nil
+}
+
+var pluginActions = map[string]string{
+	"enable":    "makeEnabled",
+	"disable":   "makeDisabled",
+	"uninstall": "doUninstall",
+}
+
+var pluginActionProgress = map[string]string{
+	"enable":    "Enabling",
+	"disable":   "Disabling",
+	"uninstall": "Uninstalling",
+}
+
+// getDependents returns the enabled plugins which have a mandatory dependency
+// on the given plugin, leaving out the plugins listed in ignore.
+func getDependents(plugins []Plugin, name string, ignore []string) []string {
+	ignored := make(map[string]bool)
+	for _, plugin := range ignore {
+		ignored[plugin] = true
+	}
+
+	dependents := make([]string, 0)
+	for _, plugin := range plugins {
+		if !plugin.Enabled || ignored[plugin.Name] {
+			continue
+		}
+		for _, dependency := range plugin.Dependencies {
+			if dependency.Name == name && !dependency.Optional {
+				dependents = append(dependents, plugin.Name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+func ManagePlugins(server string, username string, password string, action string, names []string, force bool) error {
+	endpoint, ok := pluginActions[action]
+	if !ok {
+		return fmt.Errorf("Unknown plugin action %q", action)
+	}
+
+	plugins, err := GetPlugins(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	installed := make(map[string]bool)
+	for _, plugin := range plugins {
+		installed[plugin.Name] = true
+	}
+
+	for _, name := range names {
+		if !installed[name] {
+			return fmt.Errorf("Plugin %s is not installed", name)
+		}
+		if action == "enable" || force {
+			continue
+		}
+		if dependents := getDependents(plugins, name, names); len(dependents) > 0 {
+			return fmt.Errorf("Refusing to %s plugin %s, it is required by: %s (use --force to override)", action, name, strings.Join(dependents, ", "))
+		}
+	}
+
+	for _, name := range names {
+		fmt.Printf("%s %s\n", pluginActionProgress[action], name)
+		err := postPluginAction(server, username, password, name, endpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Restart Jenkins for the changes to take effect")
+	return nil
+}
+
+func postPluginAction(server string, username string, password string, name string, endpoint string) error {
+	url := fmt.Sprintf("%s/pluginManager/plugin/%s/%s", server, name, endpoint)
+
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(username, password)
+
+	crumb, err := GetCrumb(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(crumb[0], crumb[1])
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Plugin %s cannot be changed: %s", name, resp.Status)
+	}
+	return nil
+}
+
+var pluginAttributePattern = regexp.MustCompile(`\bplugin=["']([^"'@]+)`)
+
+func getReferencedPlugins(config []byte, referenced map[string]bool) {
+	for _, match := range pluginAttributePattern.FindAllSubmatch(config, -1) {
+		referenced[string(match[1])] = true
+	}
+}
+
+// getUnusedPlugins returns the plugins which are neither referenced by a job
+// nor a (mandatory or optional) dependency of another enabled plugin.
+func getUnusedPlugins(plugins []Plugin, referenced map[string]bool) []Plugin {
+	required := make(map[string]bool)
+	for _, plugin := range plugins {
+		if !plugin.Enabled {
+			continue
+		}
+		for _, dependency := range plugin.Dependencies {
+			required[dependency.Name] = true
+		}
+	}
+
+	unused := make([]Plugin, 0)
+	for _, plugin := range plugins {
+		if !referenced[plugin.Name] && !required[plugin.Name] {
+			unused = append(unused, plugin)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].Name < unused[j].Name })
+	return unused
+}
+
+func getReferencedPluginsFromDirectory(directory string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "config.xml" {
+			return nil
+		}
+		config, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		getReferencedPlugins(config, referenced)
+		return nil
+	})
+	return referenced, err
+}
+
+func getReferencedPluginsFromServer(server string, username string, password string) (map[string]bool, error) {
+	httpClient := &JenkinsHTTPClient{
+		BasicAuthSettings: BasicAuthSettings{
+			Username: username,
+			Password: password,
+		},
+	}
+	rootJob := NewJob(server, "", httpClient)
+	jobs, err := rootJob.GetJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err = jobs.GetJobsRecursively()
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, job := range jobs.Jobs {
+		config, err := GetJobConfig(job, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", job.URL, err)
+		}
+		getReferencedPlugins(config, referenced)
+	}
+	return referenced, nil
+}
+
+func ListUnusedPlugins(server string, username string, password string, fromDir string) error {
+	plugins, err := GetPlugins(server, username, password)
+	if err != nil {
+		return err
+	}
+
+	var referenced map[string]bool
+	if fromDir != "" {
+		referenced, err = getReferencedPluginsFromDirectory(fromDir)
+	} else {
+		referenced, err = getReferencedPluginsFromServer(server, username, password)
+	}
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Version", "Description"})
+	for _, plugin := range getUnusedPlugins(plugins, referenced) {
+		table.Append([]string{plugin.Name, plugin.Version, plugin.Description})
+	}
+	table.Render()
+
+	fmt.Println("Plugins only used by pipeline steps or global configuration are not detected, double check before removing them.")
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_getDependents(t *testing.T) {
+	plugins := []Plugin{
+		{Name: "scm-api", Enabled: true},
+		{Name: "git", Enabled: true, Dependencies: []PluginDependency{{Name: "scm-api"}}},
+		{Name: "github", Enabled: true, Dependencies: []PluginDependency{{Name: "git"}, {Name: "scm-api", Optional: true}}},
+		{Name: "gitlab", Enabled: false, Dependencies: []PluginDependency{{Name: "git"}}},
+	}
+	tests := []struct {
+		name   string
+		plugin string
+		ignore []string
+		want   []string
+	}{
+		{"Mandatory dependency", "scm-api", []string{"scm-api"}, []string{"git"}},
+		{"Disabled dependents are skipped", "git", []string{"git"}, []string{"github"}},
+		{"Dependents in the same batch are skipped", "git", []string{"git", "github"}, []string{}},
+		{"Nothing depends on it", "github", []string{"github"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getDependents(plugins, tt.plugin, tt.ignore); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDependents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getUnusedPlugins(t *testing.T) {
+	plugins := []Plugin{
+		{Name: "workflow-job", Enabled: true, Dependencies: []PluginDependency{{Name: "workflow-api"}}},
+		{Name: "workflow-api", Enabled: true},
+		{Name: "git", Enabled: true, Dependencies: []PluginDependency{{Name: "scm-api", Optional: true}}},
+		{Name: "scm-api", Enabled: true},
+		{Name: "ant", Enabled: true},
+		{Name: "gradle", Enabled: false, Dependencies: []PluginDependency{{Name: "structs"}}},
+		{Name: "structs", Enabled: true},
+	}
+	referenced := make(map[string]bool)
+	getReferencedPlugins([]byte(`<?xml version='1.1' encoding='UTF-8'?>
+<flow-definition plugin="workflow-job@2.40">
+  <definition class="org.jenkinsci.plugins.workflow.cps.CpsScmFlowDefinition" plugin='workflow-cps@2.90'>
+    <scm class="hudson.plugins.git.GitSCM" plugin="git@4.7.1"/>
+  </definition>
+</flow-definition>`), referenced)
+
+	var names []string
+	for _, plugin := range getUnusedPlugins(plugins, referenced) {
+		names = append(names, plugin.Name)
+	}
+
+	want := []string{"ant", "gradle", "structs"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("getUnusedPlugins() = %v, want %v", names, want)
+	}
+}
+
+func Test_severityRank(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity string
+		want     int
+	}{
+		{"Low", "low", 0},
+		{"Mixed case", "High", 2},
+		{"Critical", "critical", 3},
+		{"Unknown counts as critical", "", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := severityRank(tt.severity); got != tt.want {
+				t.Errorf("severityRank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_countWarningsAtOrAbove(t *testing.T) {
+	warnings := []PluginWarning{
+		{ID: "SECURITY-1", Severity: "low"},
+		{ID: "SECURITY-2", Severity: "medium"},
+		{ID: "SECURITY-3", Severity: "high"},
+		{ID: "SECURITY-4"},
+	}
+	tests := []struct {
+		name     string
+		severity string
+		want     int
+	}{
+		{"Everything", "low", 4},
+		{"Medium and above", "medium", 3},
+		{"Critical only", "critical", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countWarningsAtOrAbove(warnings, tt.severity); got != tt.want {
+				t.Errorf("countWarningsAtOrAbove() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetWarningSeverities(t *testing.T) {
+	var queries []string
+	database := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, string(body))
+		w.Write([]byte(`{"vulns":[
+			{"id":"GHSA-1","references":[{"url":"https://www.jenkins.io/security/advisory/2020-01-01/#SECURITY-1"}],"database_specific":{"severity":"MODERATE"}},
+			{"id":"GHSA-2","references":[{"url":"https://www.jenkins.io/security/advisory/2020-01-01/#SECURITY-22"}],"database_specific":{"severity":"CRITICAL"}}
+		]}`))
+	}))
+	defer database.Close()
+	warnings := []PluginWarning{
+		{Plugin: "script-security", Version: "1.0", ID: "SECURITY-1"},
+		{Plugin: "script-security", Version: "1.0", ID: "SECURITY-2"},
+	}
+
+	err := SetWarningSeverities(warnings, database.URL)
+
+	if err != nil {
+		t.Fatalf("SetWarningSeverities() error = %v", err)
+	}
+	if warnings[0].Severity != "medium" || warnings[1].Severity != "" {
+		t.Errorf("SetWarningSeverities() severities = %q, %q, want medium and none", warnings[0].Severity, warnings[1].Severity)
+	}
+	want := []string{`{"package":{"ecosystem":"Maven","name":"org.jenkins-ci.plugins:script-security"},"version":"1.0"}`}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("SetWarningSeverities() queries = %v, want %v", queries, want)
+	}
+}
+
+func TestAuditPlugins(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pluginManager/api/json":
+			w.Write([]byte(`{"plugins":[{"shortName":"script-security","version":"1.0"},{"shortName":"git","version":"5.2.0"}]}`))
+		case "/scriptText":
+			w.Write([]byte(`BUTLER_RESULT:[{"plugin":"script-security","groupId":"org.jenkins-ci.plugins","version":"1.0","id":"SECURITY-1","affected":["<= 1.1"],"fixed":"1.2"}]` + "\n"))
+		case "/v1/query":
+			w.Write([]byte(`{"vulns":[{"id":"GHSA-1","references":[{"url":"https://www.jenkins.io/security/advisory/2020-01-01/#SECURITY-1"}],"database_specific":{"severity":"MODERATE"}}]}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		failOn   string
+		database string
+		wantErr  bool
+	}{
+		{"No gate", "", server.URL, false},
+		{"Below the severity", "high", server.URL, false},
+		{"At the severity", "medium", server.URL, true},
+		{"Unknown severity counts as critical", "critical", "", true},
+		{"Invalid severity", "severe", server.URL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AuditPlugins(server.URL, "user", "password", tt.failOn, tt.database)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuditPlugins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagePlugins_Endpoints(t *testing.T) {
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{"enable", "/pluginManager/plugin/ant/makeEnabled"},
+		{"disable", "/pluginManager/plugin/ant/makeDisabled"},
+		{"uninstall", "/pluginManager/plugin/ant/doUninstall"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var posted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/pluginManager/api/json":
+					w.Write([]byte(`{"plugins":[{"shortName":"ant","enabled":true}]}`))
+				case r.URL.Path == "/crumbIssuer/api/xml":
+					w.Write([]byte("Jenkins-Crumb:abc"))
+				case r.Method == "POST":
+					posted = append(posted, r.URL.Path)
+				default:
+					w.WriteHeader(404)
+				}
+			}))
+			defer server.Close()
+
+			err := ManagePlugins(server.URL, "user", "password", tt.action, []string{"ant"}, false)
+
+			if err != nil {
+				t.Fatalf("ManagePlugins() error = %v", err)
+			}
+			if !reflect.DeepEqual(posted, []string{tt.want}) {
+				t.Errorf("ManagePlugins() posted to %v, want %v", posted, []string{tt.want})
+			}
+		})
+	}
+}
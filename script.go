@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const scriptArgumentsTemplate = "args = new groovy.json.JsonSlurperClassic().parseText(<<ARGS HERE>>)\n"
+
+// GetScriptWithArguments makes arguments available to script as the `args`
+// map. They are passed like any other payload, so their values cannot
+// change the script itself.
+func GetScriptWithArguments(script string, arguments map[string]string) string {
+	marshalledArguments, _ := json.Marshal(arguments)
+	prelude := renderGroovyScript(scriptArgumentsTemplate, map[string]string{
+		"<<ARGS HERE>>": string(marshalledArguments),
+	})
+
+	// imports have to stay in front of the first statement
+	lines := strings.SplitAfter(script, "\n")
+	header := 0
+	inComment := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inComment:
+			inComment = !strings.Contains(trimmed, "*/")
+		case strings.HasPrefix(trimmed, "/*"):
+			inComment = !strings.Contains(trimmed, "*/")
+		case trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#!"):
+		case strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "package "):
+			header = i + 1
+		default:
+			return strings.Join(lines[:header], "") + prelude + strings.Join(lines[header:], "")
+		}
+	}
+	return strings.Join(lines[:header], "") + prelude + strings.Join(lines[header:], "")
+}
+
+func ParseScriptArguments(pairs []string) (map[string]string, error) {
+	arguments := make(map[string]string)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return arguments, fmt.Errorf("Invalid argument %q, expected key=value", pair)
+		}
+		arguments[parts[0]] = parts[1]
+	}
+	return arguments, nil
+}
+
+func getServerFileName(server string) string {
+	name := server
+	if parsed, err := neturl.Parse(server); err == nil && parsed.Host != "" {
+		name = parsed.Host + parsed.Path
+	}
+	return strings.Trim(strings.NewReplacer(":", "_", "/", "_").Replace(name), "_")
+}
+
+// RunScript executes a local Groovy script on the server. The output is
+// printed or, with outputDir, saved to a file named after the server. To run
+// it on many servers, use the global --servers or --profile-group.
+func RunScript(server string, username string, password string, file string, arguments map[string]string, outputDir string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	script := GetScriptWithArguments(string(data), arguments)
+
+	output, err := ExecuteGroovyScriptOnJenkins(script, server, username, password)
+	if err != nil || outputDir == "" {
+		// A failed script prints its exception instead of saving it as output
+		fmt.Print(output)
+		return err
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(outputDir, getServerFileName(server)+".txt")
+	if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Output saved to %s\n", path)
+	return nil
+}
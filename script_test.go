@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetScriptWithArguments(t *testing.T) {
+	assert := assert.New(t)
+	script := "// audit\nimport jenkins.model.Jenkins\n\nprintln args.days\n"
+
+	got := GetScriptWithArguments(script, map[string]string{"days": `30"; System.exit(0); "`})
+
+	assert.True(len(got) > len(script))
+	assert.Regexp(`^// audit\nimport jenkins.model.Jenkins\nargs = new groovy.json.JsonSlurperClassic\(\).parseText\(new String\(java.util.Base64.decoder.decode\('[A-Za-z0-9+/=]+'\), 'UTF-8'\)\)\n\nprintln args.days\n$`, got)
+	assert.NotContains(got, "System.exit")
+	values := decodedGroovyStrings(t, got)
+	assert.Equal([]string{`{"days":"30\"; System.exit(0); \""}`}, values)
+}
+
+func TestGetScriptWithArguments_NoImports(t *testing.T) {
+	got := GetScriptWithArguments("println args\n", map[string]string{})
+
+	assert.Regexp(t, `^args = .*\nprintln args\n$`, got)
+}
+
+func TestParseScriptArguments(t *testing.T) {
+	assert := assert.New(t)
+
+	arguments, err := ParseScriptArguments([]string{"days=30", "filter=a=b"})
+	assert.Nil(err)
+	assert.Equal(map[string]string{"days": "30", "filter": "a=b"}, arguments)
+
+	_, err = ParseScriptArguments([]string{"novalue"})
+	assert.NotNil(err)
+}
+
+func TestRunScript_OutputDir(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scriptText" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte("30 days\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "butler-script")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.groovy")
+	assert.Nil(ioutil.WriteFile(file, []byte("println args.days\n"), 0644))
+
+	err = RunScript(server.URL, "user", "password", file, map[string]string{"days": "30"}, filepath.Join(dir, "audit"))
+	assert.Nil(err)
+
+	output, err := ioutil.ReadFile(filepath.Join(dir, "audit", strings.Replace(strings.TrimPrefix(server.URL, "http://"), ":", "_", -1)+".txt"))
+	assert.Nil(err)
+	assert.Equal("30 days\n", string(output))
+}
+
+func TestRunScript_OutputDirOnFailure(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	dir, err := ioutil.TempDir("", "butler-script")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.groovy")
+	assert.Nil(ioutil.WriteFile(file, []byte("println args.days\n"), 0644))
+
+	err = RunScript(server.URL, "user", "password", file, map[string]string{"days": "30"}, filepath.Join(dir, "audit"))
+	assert.NotNil(err)
+
+	_, err = os.Stat(filepath.Join(dir, "audit"))
+	assert.True(os.IsNotExist(err), "no output is written for a failed script")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadTemplateValues reads the YAML values job configs are rendered with.
+func LoadTemplateValues(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return values, err
+	}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return values, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// escapeTemplateValues escapes every string of the values for XML, so a value
+// can be used in element text and attributes alike.
+func escapeTemplateValues(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(value))
+		return escaped.String()
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			escaped[key] = escapeTemplateValues(item)
+		}
+		return escaped
+	case map[interface{}]interface{}:
+		escaped := make(map[interface{}]interface{}, len(value))
+		for key, item := range value {
+			escaped[key] = escapeTemplateValues(item)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(value))
+		for i, item := range value {
+			escaped[i] = escapeTemplateValues(item)
+		}
+		return escaped
+	}
+	return value
+}
+
+// Job configs are rendered with their own delimiters, as pipeline scripts
+// and other tools' templates in a config.xml often contain {{ and }}.
+const (
+	templateLeftDelim  = "{{%"
+	templateRightDelim = "%}}"
+)
+
+// RenderJobConfig renders a config.xml as a text/template with the values.
+// Missing values are an error rather than an empty string.
+func RenderJobConfig(name string, config []byte, values map[string]interface{}) ([]byte, error) {
+	return renderTemplate(name, config, escapeTemplateValues(values))
+}
+
+// RenderJenkinsfile renders an extracted Jenkinsfile like RenderJobConfig.
+// The values stay unescaped, the script is escaped as a whole when it is put
+// back into the config.
+func RenderJenkinsfile(name string, script []byte, values map[string]interface{}) ([]byte, error) {
+	return renderTemplate(name+"/"+jenkinsfileName, script, values)
+}
+
+func renderTemplate(name string, text []byte, values interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Delims(templateLeftDelim, templateRightDelim).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return []byte{}, err
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, values)
+	if err != nil {
+		return []byte{}, err
+	}
+	return out.Bytes(), nil
+}
+
+// GetJobConfigForImport reads an exported job and applies the import options
+// to it, which is exactly what ImportJob posts to Jenkins.
+func GetJobConfigForImport(name string, options ImportOptions) ([]byte, error) {
+	config, err := ioutil.ReadFile("jobs/" + name + "/config.xml")
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if options.Values != nil {
+		config, err = RenderJobConfig(name, config, options.Values)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	// the Jenkinsfile is put back before credential references are
+	// rewritten, so references in the script are rewritten too
+	script, err := readJenkinsfile("jobs/" + name)
+	if err != nil {
+		return []byte{}, err
+	}
+	if script != nil {
+		if options.Values != nil {
+			script, err = RenderJenkinsfile(name, script, options.Values)
+			if err != nil {
+				return []byte{}, err
+			}
+		}
+		config = InjectPipelineScript(config, script)
+	}
+
+	if len(options.CredentialsMapping) > 0 {
+		config = RewriteCredentialReferences(config, options.CredentialsMapping)
+	}
+
+	return config, nil
+}
+
+// RenderJobs previews the configs of the exported jobs as they would be
+// imported. Without outputDir they are printed, otherwise they are written to
+// <outputDir>/<job>/config.xml.
+func RenderJobs(names []string, options ImportOptions, outputDir string) error {
+	if len(names) == 0 {
+		jobs, err := ioutil.ReadDir("jobs")
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if job.IsDir() {
+				names = append(names, job.Name())
+			}
+		}
+	}
+
+	for _, name := range names {
+		config, err := GetJobConfigForImport(name, options)
+		if err != nil {
+			return err
+		}
+
+		if outputDir == "" {
+			if len(names) > 1 {
+				fmt.Printf("==> %s <==\n", name)
+			}
+			fmt.Printf("%s\n", bytes.TrimRight(config, "\n"))
+			continue
+		}
+
+		directory := filepath.Join(outputDir, name)
+		err = os.MkdirAll(directory, 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(directory, "config.xml"), config, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rendered job: %s\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderJobConfig(t *testing.T) {
+	assert := assert.New(t)
+	values := map[string]interface{}{
+		"label": "linux && docker",
+		"git":   map[interface{}]interface{}{"url": "https://git.example.com/app.git"},
+		"envs":  []interface{}{"dev", "prod"},
+	}
+	config := `<project><assignedNode>{{% .label %}}</assignedNode><url>{{% .git.url %}}</url>{{% range .envs %}}<env name="{{% . %}}"/>{{% end %}}</project>`
+
+	got, err := RenderJobConfig("app", []byte(config), values)
+
+	assert.Nil(err)
+	assert.Equal(`<project><assignedNode>linux &amp;&amp; docker</assignedNode><url>https://git.example.com/app.git</url><env name="dev"/><env name="prod"/></project>`, string(got))
+}
+
+func TestRenderJobConfig_MissingValue(t *testing.T) {
+	_, err := RenderJobConfig("app", []byte(`<project>{{% .label %}}</project>`), map[string]interface{}{})
+
+	assert.NotNil(t, err)
+}
+
+func TestRenderJobConfig_LiteralBraces(t *testing.T) {
+	config := `<flow-definition><script>sh &apos;docker inspect -f &quot;{{ .State.Status }}&quot; {{% .container %}}&apos;</script></flow-definition>`
+
+	got, err := RenderJobConfig("app", []byte(config), map[string]interface{}{"container": "app"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, `<flow-definition><script>sh &apos;docker inspect -f &quot;{{ .State.Status }}&quot; app&apos;</script></flow-definition>`, string(got))
+}
+
+func TestGetJobConfigForImport(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-jobs")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(directory)
+
+	os.MkdirAll(filepath.Join("jobs", "app"), 0755)
+	ioutil.WriteFile(filepath.Join("jobs", "app", "config.xml"), []byte(`<project><credentialsId>{{% .credentials %}}</credentialsId><script>echo "${BRANCH}"</script></project>`), 0644)
+	ioutil.WriteFile("prod.yaml", []byte("credentials: git-dev\n"), 0644)
+
+	values, err := LoadTemplateValues("prod.yaml")
+	assert.Nil(err)
+	got, err := GetJobConfigForImport("app", ImportOptions{Values: values, CredentialsMapping: map[string]string{"git-dev": "git-prod"}})
+
+	assert.Nil(err)
+	assert.Equal(`<project><credentialsId>git-prod</credentialsId><script>echo "${BRANCH}"</script></project>`, string(got))
+
+	got, err = GetJobConfigForImport("app", ImportOptions{})
+	assert.Nil(err)
+	assert.Contains(string(got), "{{% .credentials %}}")
+}
+
+func TestGetJobConfigForImport_TemplatedJenkinsfile(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-jobs")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(directory)
+
+	os.MkdirAll(filepath.Join("jobs", "app"), 0755)
+	ioutil.WriteFile(filepath.Join("jobs", "app", "config.xml"), []byte(`<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script/></definition></flow-definition>`), 0644)
+	ioutil.WriteFile(filepath.Join("jobs", "app", "Jenkinsfile"), []byte(`git credentialsId: '{{% .credentials %}}', url: "{{% .url %}}"`), 0644)
+
+	got, err := GetJobConfigForImport("app", ImportOptions{
+		Values:             map[string]interface{}{"credentials": "git-dev", "url": "https://example.com/a&b.git"},
+		CredentialsMapping: map[string]string{"git-dev": "git-prod"},
+	})
+
+	assert.Nil(err)
+	assert.Equal(`<flow-definition><definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script>git credentialsId: &apos;git-prod&apos;, url: &quot;https://example.com/a&amp;b.git&quot;</script></definition></flow-definition>`, string(got))
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type View struct {
+	Class string `json:"_class"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+}
+
+type ViewList struct {
+	Views []View `json:"views"`
+}
+
+// IsAllView tells whether the view is the built-in view of all jobs, which
+// every controller and folder already has.
+func (view *View) IsAllView() bool {
+	return view.Class == "hudson.model.AllView"
+}
+
+func GetViewURL(server string, folderName string, name string) string {
+	return fmt.Sprintf("%s/view/%s", GetFolderURL(server, folderName), neturl.PathEscape(name))
+}
+
+// GetViews returns the views of a folder, or of the controller without one.
+func GetViews(server string, folderName string, username string, password string) ([]View, error) {
+	url := fmt.Sprintf("%s/api/json?tree=views[name,url]", GetFolderURL(server, folderName))
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return []View{}, err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return []View{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 401 {
+		return []View{}, errors.New("Unauthorized 401")
+	}
+
+	if resp.StatusCode != 200 {
+		return []View{}, fmt.Errorf("Views cannot be read: %s", resp.Status)
+	}
+
+	var list ViewList
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		return []View{}, err
+	}
+	return list.Views, nil
+}
+
+// Recursive exports mirror the folder tree like the URLs of Jenkins do, so
+// views and folders of the same name can't collide:
+// <directory>/view/<view>/config.xml for the views of the folder and
+// <directory>/job/<folder>/... for its subfolders.
+const (
+	viewsDirectory   = "view"
+	foldersDirectory = "job"
+)
+
+// isSafeFileName tells whether a name of Jenkins can be used as a directory
+// name without escaping the directory it is written to.
+func isSafeFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// ExportViews writes the config.xml of every view of a folder to
+// <directory>/<view>/config.xml.
+func ExportViews(server string, folderName string, username string, password string, directory string) error {
+	views, err := GetViews(server, folderName, username, password)
+	if err != nil {
+		return err
+	}
+
+	for _, view := range views {
+		if view.IsAllView() {
+			continue
+		}
+		if !isSafeFileName(view.Name) {
+			return fmt.Errorf("View %q cannot be exported: its name is not a valid directory name", view.Name)
+		}
+		fmt.Printf("Exporting view: %s\n", view.Name)
+		config, err := getConfigXML(GetViewURL(server, folderName, view.Name), username, password)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Join(directory, view.Name), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(directory, view.Name, "config.xml"), config, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFolderDirectory returns the directory of a folder in a recursive export
+// of the views of parentName.
+func getFolderDirectory(directory string, parentName string, folderName string) (string, error) {
+	relative := strings.Trim(strings.TrimPrefix(folderName, strings.Trim(parentName, "/")), "/")
+	if relative == "" {
+		return directory, nil
+	}
+	for _, segment := range strings.Split(relative, "/") {
+		if !isSafeFileName(segment) {
+			return "", fmt.Errorf("Folder %q cannot be exported: its name is not a valid directory name", folderName)
+		}
+		directory = filepath.Join(directory, foldersDirectory, segment)
+	}
+	return directory, nil
+}
+
+// ExportViewsRecursively exports the views of a folder, or of the controller
+// without one, and of all folders below it, mirroring the folder tree.
+func ExportViewsRecursively(server string, folderName string, username string, password string, directory string) error {
+	folderNames, err := getFolderNamesRecursively(server, folderName, username, password)
+	if err != nil {
+		return err
+	}
+	if folderName == "" {
+		folderNames = append([]string{""}, folderNames...)
+	}
+
+	for _, name := range folderNames {
+		folderDirectory, err := getFolderDirectory(directory, folderName, name)
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			fmt.Printf("Exporting views of folder: %s\n", name)
+		}
+		err = ExportViews(server, name, username, password, filepath.Join(folderDirectory, viewsDirectory))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportView creates a view in a folder, or updates it if it exists.
+func ImportView(server string, folderName string, name string, username string, password string, config []byte) error {
+	viewURL := GetViewURL(server, folderName, name)
+	exists, err := itemExists(viewURL, username, password)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return postConfigXML(server, viewURL+"/config.xml", username, password, config)
+	}
+	url := fmt.Sprintf("%s/createView?name=%s", GetFolderURL(server, folderName), neturl.QueryEscape(name))
+	return postConfigXML(server, url, username, password, config)
+}
+
+// ImportViews imports the views exported to directory by ExportViews.
+func ImportViews(server string, folderName string, username string, password string, directory string) error {
+	failed, err := importViews(server, folderName, username, password, directory)
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Views couldn't be imported: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// importViews imports the views of a directory and returns the views that
+// couldn't be imported.
+func importViews(server string, folderName string, username string, password string, directory string) ([]string, error) {
+	views, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make([]string, 0)
+	for _, view := range views {
+		if !view.IsDir() {
+			continue
+		}
+		fmt.Printf("Import view: %s\n", view.Name())
+		config, err := ioutil.ReadFile(filepath.Join(directory, view.Name(), "config.xml"))
+		if err != nil {
+			return nil, err
+		}
+		err = ImportView(server, folderName, view.Name(), username, password, config)
+		if err != nil {
+			fmt.Printf("%s: %v\n", view.Name(), err)
+			failed = append(failed, view.Name())
+		}
+	}
+	return failed, nil
+}
+
+// ImportViewsRecursively imports the views exported to directory by
+// ExportViewsRecursively into folderName and the folders below it. The
+// folders have to exist already.
+func ImportViewsRecursively(server string, folderName string, username string, password string, directory string) error {
+	failed := make([]string, 0)
+	var importFolder func(folderName string, directory string) error
+	importFolder = func(folderName string, directory string) error {
+		if fileExists(filepath.Join(directory, viewsDirectory)) {
+			if folderName != "" {
+				fmt.Printf("Importing views of folder: %s\n", folderName)
+			}
+			folderFailed, err := importViews(server, folderName, username, password, filepath.Join(directory, viewsDirectory))
+			if err != nil {
+				return err
+			}
+			for _, view := range folderFailed {
+				failed = append(failed, strings.TrimLeft(folderName+"/"+view, "/"))
+			}
+		}
+
+		folders, err := ioutil.ReadDir(filepath.Join(directory, foldersDirectory))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, folder := range folders {
+			if !folder.IsDir() {
+				continue
+			}
+			err := importFolder(strings.TrimLeft(folderName+"/"+folder.Name(), "/"), filepath.Join(directory, foldersDirectory, folder.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := importFolder(strings.Trim(folderName, "/"), directory)
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Views couldn't be imported: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
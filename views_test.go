@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportViews(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-views")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/job/team/api/json":
+			w.Write([]byte(`{"views":[{"_class":"hudson.model.AllView","name":"all"},{"_class":"hudson.model.ListView","name":"my view"}]}`))
+		case "/job/team/view/my view/config.xml":
+			w.Write([]byte(`<hudson.model.ListView><name>my view</name></hudson.model.ListView>`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	err = ExportViews(server.URL, "team", "user", "password", directory)
+
+	assert.Nil(err)
+	files, _ := ioutil.ReadDir(directory)
+	assert.Len(files, 1)
+	config, err := ioutil.ReadFile(filepath.Join(directory, "my view", "config.xml"))
+	assert.Nil(err)
+	assert.Equal(`<hudson.model.ListView><name>my view</name></hudson.model.ListView>`, string(config))
+}
+
+func TestImportView(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		want   string
+	}{
+		{"create", false, "/job/team/createView?name=my+view"},
+		{"update", true, "/job/team/view/my%20view/config.xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/crumbIssuer/api/xml":
+					w.Write([]byte("Jenkins-Crumb:abc"))
+				case r.Method == "GET" && r.URL.Path == "/job/team/view/my view/api/json" && tt.exists:
+					w.Write([]byte(`{}`))
+				case r.Method == "GET":
+					w.WriteHeader(404)
+				default:
+					body, _ := ioutil.ReadAll(r.Body)
+					assert.Equal(t, "<hudson.model.ListView/>", string(body))
+					posted = append(posted, r.URL.RequestURI())
+				}
+			}))
+			defer server.Close()
+
+			err := ImportView(server.URL, "team", "my view", "user", "password", []byte("<hudson.model.ListView/>"))
+
+			assert.Nil(t, err)
+			assert.Equal(t, []string{tt.want}, posted)
+		})
+	}
+}
+
+// newViewsServer fakes a Jenkins with the view team and the folder team, which
+// has the view dev.
+func newViewsServer(t *testing.T) *testJenkinsServer {
+	return newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/api/xml": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `<hudson><job _class="com.cloudbees.hudson.plugins.folder.Folder"><name>team</name><url>http://%s/job/team/</url></job></hudson>`, r.Host)
+		},
+		"/job/team/api/xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<com.cloudbees.hudson.plugins.folder.Folder/>`))
+		},
+		"/api/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"views":[{"_class":"hudson.model.AllView","name":"all"},{"_class":"hudson.model.ListView","name":"team"}]}`))
+		},
+		"/job/team/api/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"views":[{"_class":"hudson.model.ListView","name":"dev"}]}`))
+		},
+		"/view/team/config.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<hudson.model.ListView><name>team</name></hudson.model.ListView>`))
+		},
+		"/job/team/view/dev/config.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<hudson.model.ListView><name>dev</name></hudson.model.ListView>`))
+		},
+		"/createView":          func(w http.ResponseWriter, r *http.Request) {},
+		"/job/team/createView": func(w http.ResponseWriter, r *http.Request) {},
+	})
+}
+
+func TestExportViewsRecursively(t *testing.T) {
+	assert := assert.New(t)
+	directory, err := ioutil.TempDir("", "butler-views")
+	assert.Nil(err)
+	defer os.RemoveAll(directory)
+	server := newViewsServer(t)
+	defer server.Close()
+
+	err = ExportViewsRecursively(server.URL, "", "user", "password", directory)
+
+	assert.Nil(err)
+	config, err := ioutil.ReadFile(filepath.Join(directory, "view", "team", "config.xml"))
+	assert.Nil(err)
+	assert.Equal(`<hudson.model.ListView><name>team</name></hudson.model.ListView>`, string(config))
+	config, err = ioutil.ReadFile(filepath.Join(directory, "job", "team", "view", "dev", "config.xml"))
+	assert.Nil(err)
+	assert.Equal(`<hudson.model.ListView><name>dev</name></hudson.model.ListView>`, string(config))
+
+	err = ImportViewsRecursively(server.URL, "", "user", "password", directory)
+
+	assert.Nil(err)
+	assert.Len(server.Requests("/createView"), 1)
+	assert.Equal([]string{"team"}, server.Requests("/createView")[0].Form["name"])
+	assert.Len(server.Requests("/job/team/createView"), 1)
+}
+
+func TestExportViews_UnsafeName(t *testing.T) {
+	directory, err := ioutil.TempDir("", "butler-views")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	server := newTestJenkinsServer(map[string]http.HandlerFunc{
+		"/api/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"views":[{"_class":"hudson.model.ListView","name":".."}]}`))
+		},
+	})
+	defer server.Close()
+
+	err = ExportViews(server.URL, "", "user", "password", filepath.Join(directory, "views"))
+
+	assert.EqualError(t, err, `View ".." cannot be exported: its name is not a valid directory name`)
+}